@@ -5,11 +5,86 @@ package roaring
 import (
 	"fmt"
 	"math/bits"
+	"runtime"
+	"sync"
 	"unsafe"
 )
 
 // Add two BSI bitmaps producing a new BSI bitmap.
 func Add(x, y []*Bitmap) []*Bitmap {
+	var carryRing [2]carryBuffer
+	var temp [1024]uint64
+	var dst []*Bitmap
+	addKeys(x, y, 0, ^uint64(0), &carryRing, &temp, func(i int, key uint64, c *Container) {
+		for i >= len(dst) {
+			dst = append(dst, NewBitmap())
+		}
+		dst[i].Containers.Put(key, c)
+	})
+	return dst
+}
+
+// AddParallel is Add, with the container keys partitioned into ranges
+// which are summed by a pool of up to workers goroutines, each with its
+// own carry ring and temp buffer. A workers count of 0 or less means
+// runtime.GOMAXPROCS(0). The inputs must not be modified while it runs.
+func AddParallel(x, y []*Bitmap, workers int) []*Bitmap {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	keys := bsiKeys(x, y)
+	// A few ranges per worker evens out keys which cost more than others.
+	parts := min(len(keys), workers*4)
+	if workers == 1 || parts <= 1 {
+		return Add(x, y)
+	}
+
+	type result struct {
+		slice int
+		key   uint64
+		c     *Container
+	}
+	results := make([][]result, parts)
+	next := make(chan int, parts)
+	for p := 0; p < parts; p++ {
+		next <- p
+	}
+	close(next)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, parts); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var carryRing [2]carryBuffer
+			var temp [1024]uint64
+			for p := range next {
+				first, last := keys[p*len(keys)/parts], keys[(p+1)*len(keys)/parts-1]
+				addKeys(x, y, first, last, &carryRing, &temp, func(i int, key uint64, c *Container) {
+					results[p] = append(results[p], result{slice: i, key: key, c: c})
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The ranges are in key order, so this puts containers in order.
+	var dst []*Bitmap
+	for _, part := range results {
+		for _, r := range part {
+			for r.slice >= len(dst) {
+				dst = append(dst, NewBitmap())
+			}
+			dst[r.slice].Containers.Put(r.key, r.c)
+		}
+	}
+	return dst
+}
+
+// addKeys sums the container keys of x and y within [first, last], calling
+// emit with each non-empty output container and the slice it belongs to.
+// It only reads from x and y, so calls over disjoint key ranges may run
+// concurrently, given their own carry ring and temp buffer.
+func addKeys(x, y []*Bitmap, first, last uint64, carryRing *[2]carryBuffer, temp *[1024]uint64, emit func(i int, key uint64, c *Container)) {
 	// Collect iterators.
 	type itNode struct {
 		it   ContainerIterator
@@ -17,35 +92,31 @@ func Add(x, y []*Bitmap) []*Bitmap {
 		key  uint64
 		done bool
 	}
+	// advance moves node to its next container within the key range.
+	advance := func(node *itNode) {
+		if node.it.Next() {
+			node.key, node.c = node.it.Value()
+			if node.key <= last {
+				return
+			}
+		}
+		node.done = true
+	}
 	xits := make([]itNode, len(x))
 	for i, b := range x {
-		it, _ := b.Containers.Iterator(0)
+		it, _ := b.Containers.Iterator(first)
 		defer it.Close()
 
-		node := &xits[i]
-
-		node.it = it
-		if !it.Next() {
-			node.done = true
-			continue
-		}
-
-		node.key, node.c = it.Value()
+		xits[i].it = it
+		advance(&xits[i])
 	}
 	yits := make([]itNode, len(y))
 	for i, b := range y {
-		it, _ := b.Containers.Iterator(0)
+		it, _ := b.Containers.Iterator(first)
 		defer it.Close()
 
-		node := &yits[i]
-
-		node.it = it
-		if !it.Next() {
-			node.done = true
-			continue
-		}
-
-		node.key, node.c = it.Value()
+		yits[i].it = it
+		advance(&yits[i])
 	}
 
 	bits := len(x)
@@ -53,9 +124,6 @@ func Add(x, y []*Bitmap) []*Bitmap {
 		bits = len(y)
 	}
 
-	var carryRing [2]carryBuffer
-	var temp [1024]uint64
-	var dst []*Bitmap
 	for {
 		key := ^uint64(0)
 		for i := range xits {
@@ -87,36 +155,104 @@ func Add(x, y []*Bitmap) []*Bitmap {
 			var x, y *Container
 			if i < len(xits) && xits[i].key == key && !xits[i].done {
 				x = xits[i].c
-				if xits[i].it.Next() {
-					xits[i].key, xits[i].c = xits[i].it.Value()
-				} else {
-					xits[i].done = true
-				}
+				advance(&xits[i])
 			}
 			if i < len(yits) && yits[i].key == key && !yits[i].done {
 				y = yits[i].c
-				if yits[i].it.Next() {
-					yits[i].key, yits[i].c = yits[i].it.Value()
-				} else {
-					yits[i].done = true
-				}
+				advance(&yits[i])
 			}
 
-			c := fullAddContainers(x, y, &carryRing[i%2], &carryRing[1-(i%2)], &temp)
+			c := fullAddContainers(x, y, &carryRing[i%2], &carryRing[1-(i%2)], temp)
 			if c == nil {
 				continue
 			}
 
+			emit(i, key, c)
+		}
+	}
+}
+
+// Count returns a BSI, in the layout used by Add, holding the number of
+// the given bitmaps each column is present in. For each container key, the
+// containers of every bitmap are added into a counter one at a time, with
+// the carry rippling up through the counter's bits.
+func Count(bitmaps ...*Bitmap) []*Bitmap {
+	var carryRing [2]carryBuffer
+	var temp [1024]uint64
+	var counter []*Container
+	var dst []*Bitmap
+	for _, key := range bsiKeys(bitmaps) {
+		counter = counter[:0]
+		for _, b := range bitmaps {
+			x := b.Containers.Get(key)
+			if x.N() == 0 {
+				continue
+			}
+			carryRing[0].clear()
+			for i := 0; ; i++ {
+				if i == len(counter) {
+					counter = append(counter, nil)
+				}
+				carryOut := &carryRing[1-(i%2)]
+				counter[i] = fullAddContainers(counter[i], x, &carryRing[i%2], carryOut, &temp)
+				x = nil
+				if carryOut.count == 0 {
+					break
+				}
+			}
+		}
+
+		for i, c := range counter {
+			if c.N() == 0 {
+				continue
+			}
 			for i >= len(dst) {
 				dst = append(dst, NewBitmap())
 			}
-			dst[i].Containers.Put(key, c)
+			dst[i].Containers.Put(key, c.Freeze())
 		}
 	}
 
 	return dst
 }
 
+// Threshold returns the columns present in at least k of the given
+// bitmaps. A k of 0 or less gives every column present in any of them.
+func Threshold(k int, bitmaps ...*Bitmap) *Bitmap {
+	if k > len(bitmaps) {
+		return NewBitmap()
+	}
+	counts := Count(bitmaps...)
+	if k <= 1 {
+		return NewBitmap().Union(counts...)
+	}
+	return Range(counts, RangeGTE, uint64(k), nil)
+}
+
+// WeightedSum returns a BSI, in the layout used by Add, holding for each
+// column the sum of weights[i] over the bitmaps[i] it is present in. The
+// two slices must be the same length. Each bitmap is placed in the slices
+// matching the set bits of its weight, and the results are summed with Add.
+func WeightedSum(bitmaps []*Bitmap, weights []uint64) []*Bitmap {
+	var dst []*Bitmap
+	for i, b := range bitmaps {
+		w := weights[i]
+		if w == 0 {
+			continue
+		}
+		y := make([]*Bitmap, bits.Len64(w))
+		for j := range y {
+			if w&(1<<j) != 0 {
+				y[j] = b
+			} else {
+				y[j] = NewBitmap()
+			}
+		}
+		dst = Add(dst, y)
+	}
+	return dst
+}
+
 // fullAddContainers implements the bitwise formula for a 3-input-2-output full adder.
 // Any of the 3 inputs may be nil, in which case they are treated as zeroes.
 // The carry is written to carryOut, which must not be nil.
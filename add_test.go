@@ -403,3 +403,148 @@ func TestAdd(t *testing.T) {
 		})
 	}
 }
+
+// TestCount checks Count and Threshold against per-column tallies.
+func TestCount(t *testing.T) {
+	var pcg rand.PCGSource
+	pcg.Seed(18)
+	rnd := rand.New(&pcg)
+
+	bitmaps := make([]*Bitmap, 21)
+	tally := map[uint64]int{}
+	for i := range bitmaps {
+		b := NewBitmap()
+		// Sparse columns everywhere, plus a dense range to get bitmap
+		// and run containers.
+		for n := rnd.Intn(3000); n > 0; n-- {
+			b.DirectAdd(rnd.Uint64() % (8 << 16))
+		}
+		start := rnd.Uint64() % (4 << 16)
+		b.AddRange(start, start+rnd.Uint64()%(2<<16))
+		if i%5 == 0 {
+			b.Optimize()
+		}
+		for _, v := range b.Slice() {
+			tally[v]++
+		}
+		bitmaps[i] = b
+	}
+
+	counts := Count(bitmaps...)
+	got := map[uint64]int{}
+	for i, b := range counts {
+		for _, v := range b.Slice() {
+			got[v] |= 1 << i
+		}
+	}
+	if len(got) != len(tally) {
+		t.Fatalf("expected %d columns, got %d", len(tally), len(got))
+	}
+	for v, n := range tally {
+		if got[v] != n {
+			t.Fatalf("column %d: expected count %d, got %d", v, n, got[v])
+		}
+	}
+
+	for _, k := range []int{-1, 0, 1, 2, 5, 11, 21, 22} {
+		want := NewBitmap()
+		for v, n := range tally {
+			if n >= k {
+				want.DirectAdd(v)
+			}
+		}
+		if got := Threshold(k, bitmaps...); got.Compare(want) != 0 {
+			t.Fatalf("threshold %d: expected %d columns, got %d", k, want.Count(), got.Count())
+		}
+	}
+	if Count() != nil || Threshold(1).Any() {
+		t.Fatal("expected empty results with no bitmaps")
+	}
+}
+
+// TestWeightedSum checks WeightedSum against per-column sums, and that the
+// result ranks with TopK.
+func TestWeightedSum(t *testing.T) {
+	var pcg rand.PCGSource
+	pcg.Seed(19)
+	rnd := rand.New(&pcg)
+
+	bitmaps := make([]*Bitmap, 12)
+	weights := make([]uint64, len(bitmaps))
+	sums := map[uint64]uint64{}
+	for i := range bitmaps {
+		b := NewBitmap()
+		for n := rnd.Intn(5000); n > 0; n-- {
+			b.DirectAdd(rnd.Uint64() % (4 << 16))
+		}
+		weights[i] = rnd.Uint64() % 1000
+		if i == 3 {
+			weights[i] = 0
+		}
+		for _, v := range b.Slice() {
+			sums[v] += weights[i]
+		}
+		bitmaps[i] = b
+	}
+
+	exists := NewBitmap().Union(bitmaps...)
+	sum := NewBSIFromSlices(exists, WeightedSum(bitmaps, weights))
+	for v, want := range sums {
+		if got, _ := sum.Value(v); uint64(got) != want {
+			t.Fatalf("column %d: expected %d, got %d", v, want, got)
+		}
+	}
+
+	top := sum.TopK(10, nil)
+	lowest := uint64(1<<64 - 1)
+	for _, v := range top.Slice() {
+		lowest = min(lowest, sums[v])
+	}
+	for v, s := range sums {
+		if !top.Contains(v) && s > lowest {
+			t.Fatalf("column %d with sum %d missing from top 10", v, s)
+		}
+	}
+}
+
+// TestAddParallel checks that AddParallel matches Add, across backends and
+// worker counts.
+func TestAddParallel(t *testing.T) {
+	var pcg rand.PCGSource
+	pcg.Seed(20)
+	rnd := rand.New(&pcg)
+
+	for _, newBitmap := range []func() *Bitmap{
+		func() *Bitmap { return NewBitmap() },
+		func() *Bitmap { return NewBTreeBitmap() },
+		func() *Bitmap { return NewMapBitmap() },
+		func() *Bitmap { return NewARTBitmap() },
+	} {
+		random := func(depth int) []*Bitmap {
+			s := make([]*Bitmap, depth)
+			for i := range s {
+				s[i] = newBitmap()
+				for n := rnd.Intn(20000); n > 0; n-- {
+					s[i].DirectAdd(rnd.Uint64() % (1 << 26))
+				}
+			}
+			return s
+		}
+		x, y := random(9), random(13)
+		want := Add(x, y)
+		for _, workers := range []int{0, 1, 2, 3, 16, 100} {
+			got := AddParallel(x, y, workers)
+			if len(got) != len(want) {
+				t.Fatalf("%d workers: expected %d slices, got %d", workers, len(want), len(got))
+			}
+			for i := range want {
+				if got[i].Compare(want[i]) != 0 {
+					t.Fatalf("%d workers: slice %d differs", workers, i)
+				}
+			}
+		}
+	}
+	if got := AddParallel(nil, nil, 4); got != nil {
+		t.Fatalf("expected no slices, got %d", len(got))
+	}
+}
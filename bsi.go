@@ -0,0 +1,930 @@
+// Copyright 2022 Molecula Corp. (DBA FeatureBase).
+// SPDX-License-Identifier: Apache-2.0
+package roaring
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+)
+
+// BSI is a bit-sliced integer: a set of columns, each holding a signed
+// value. Values are stored as sign-magnitude across rows laid out the way
+// BitmapBSICountFilter expects them: row 0 is the existence row, row 1 is
+// the sign row, and the rows after that hold the magnitude bits, least
+// significant first. The magnitude rows are exactly the slices Add works
+// with.
+type BSI struct {
+	rows []*Bitmap
+}
+
+// NewBSI returns an empty BSI.
+func NewBSI() *BSI {
+	return &BSI{rows: []*Bitmap{NewBitmap(), NewBitmap()}}
+}
+
+// NewBSIFromRows wraps rows in BitmapBSICountFilter order (existence, sign,
+// then magnitude bits) in a BSI. The bitmaps are used directly, not copied.
+// Missing or nil rows are treated as empty.
+func NewBSIFromRows(rows []*Bitmap) *BSI {
+	b := &BSI{rows: make([]*Bitmap, max(len(rows), 2))}
+	for i := range b.rows {
+		if i < len(rows) && rows[i] != nil {
+			b.rows[i] = rows[i]
+		} else {
+			b.rows[i] = NewBitmap()
+		}
+	}
+	return b
+}
+
+// NewBSIFromSlices builds a BSI from an existence bitmap and unsigned
+// magnitude slices, as returned by Add. The bitmaps are used directly, not
+// copied. If exists is nil, every column with a non-zero value is taken to
+// exist.
+func NewBSIFromSlices(exists *Bitmap, slices []*Bitmap) *BSI {
+	if exists == nil {
+		exists = NewBitmap().Union(slices...)
+	}
+	rows := make([]*Bitmap, 0, len(slices)+2)
+	rows = append(rows, exists, NewBitmap())
+	return NewBSIFromRows(append(rows, slices...))
+}
+
+// Existence returns the bitmap of columns holding a value.
+func (b *BSI) Existence() *Bitmap {
+	return b.rows[0]
+}
+
+// Sign returns the bitmap of columns holding a negative value.
+func (b *BSI) Sign() *Bitmap {
+	return b.rows[1]
+}
+
+// Slices returns the magnitude bits, least significant first, in the
+// layout used by Add.
+func (b *BSI) Slices() []*Bitmap {
+	return b.rows[2:]
+}
+
+// Rows returns every row in BitmapBSICountFilter order.
+func (b *BSI) Rows() []*Bitmap {
+	return b.rows
+}
+
+// BitDepth returns the number of magnitude bits.
+func (b *BSI) BitDepth() int {
+	return len(b.rows) - 2
+}
+
+// SetValue sets the value of col, replacing any existing value.
+func (b *BSI) SetValue(col uint64, v int64) {
+	mag := uint64(v)
+	if v < 0 {
+		mag = -mag
+	}
+	for depth := bits.Len64(mag); b.BitDepth() < depth; {
+		b.rows = append(b.rows, NewBitmap())
+	}
+	b.rows[0].DirectAdd(col)
+	if v < 0 {
+		b.rows[1].DirectAdd(col)
+	} else {
+		b.rows[1].remove(col)
+	}
+	for i, row := range b.rows[2:] {
+		if mag&(1<<i) != 0 {
+			row.DirectAdd(col)
+		} else {
+			row.remove(col)
+		}
+	}
+}
+
+// Value returns the value of col, and whether it has one.
+func (b *BSI) Value(col uint64) (int64, bool) {
+	if !b.rows[0].Contains(col) {
+		return 0, false
+	}
+	var mag uint64
+	for i, row := range b.rows[2:] {
+		if row.Contains(col) {
+			mag |= 1 << i
+		}
+	}
+	if b.rows[1].Contains(col) {
+		return -int64(mag), true
+	}
+	return int64(mag), true
+}
+
+// ClearValue removes the value of col, if any.
+func (b *BSI) ClearValue(col uint64) {
+	for _, row := range b.rows {
+		row.remove(col)
+	}
+}
+
+// Fragment returns the columns of b within the given shard as a single
+// bitmap in fragment layout: row r occupies positions
+// [r*ShardWidth, (r+1)*ShardWidth). This is the layout
+// BitmapBSICountFilter consumes through ApplyFilterToIterator. Containers
+// are shared with b, frozen.
+func (b *BSI) Fragment(shard uint64) *Bitmap {
+	frag := NewBitmap()
+	base := shard << rowExponent
+	for r, row := range b.rows {
+		citer, _ := row.Containers.Iterator(base)
+		for citer.Next() {
+			k, c := citer.Value()
+			if k < base {
+				continue
+			}
+			if k >= base+rowWidth {
+				break
+			}
+			if c.N() == 0 {
+				continue
+			}
+			frag.Containers.Put(uint64(r)<<rowExponent|k&keyMask, c.Freeze())
+		}
+		citer.Close()
+	}
+	return frag
+}
+
+// NewBSIFromFragment is the inverse of Fragment: it reads a bitmap in
+// fragment layout and places its columns in the given shard.
+func NewBSIFromFragment(shard uint64, frag *Bitmap) *BSI {
+	b := NewBSI()
+	base := shard << rowExponent
+	citer, _ := frag.Containers.Iterator(0)
+	defer citer.Close()
+	for citer.Next() {
+		k, c := citer.Value()
+		if c.N() == 0 {
+			continue
+		}
+		r := int(k >> rowExponent)
+		for len(b.rows) <= r {
+			b.rows = append(b.rows, NewBitmap())
+		}
+		b.rows[r].Containers.Put(base|k&keyMask, c.Freeze())
+	}
+	return b
+}
+
+// Subtract computes x - y for two unsigned BSI slices, as used by Add. The
+// result is returned in sign-magnitude form: diff holds the magnitude of
+// the difference, and neg holds the columns where y was greater than x,
+// ready to be used as a sign row.
+func Subtract(x, y []*Bitmap) (diff []*Bitmap, neg *Bitmap) {
+	n := max(len(x), len(y))
+	xs, ys := make([]*Container, n), make([]*Container, n)
+	out := make([]*Container, n)
+	neg = NewBitmap()
+	for _, key := range bsiKeys(x, y) {
+		for i := 0; i < n; i++ {
+			xs[i], ys[i] = nil, nil
+			if i < len(x) {
+				xs[i] = x[i].Containers.Get(key)
+			}
+			if i < len(y) {
+				ys[i] = y[i].Containers.Get(key)
+			}
+		}
+		borrow := subtractContainers(out, xs, ys)
+		for i, c := range out {
+			if c.N() == 0 {
+				continue
+			}
+			for i >= len(diff) {
+				diff = append(diff, NewBitmap())
+			}
+			diff[i].Containers.Put(key, c)
+		}
+		if borrow.N() != 0 {
+			neg.Containers.Put(key, borrow)
+		}
+	}
+	return diff, neg
+}
+
+// subtractContainers runs a ripple-borrow full subtractor over the bits of
+// one container key, writing the magnitude of x - y to dst and returning
+// the columns which came out negative. Nil containers are zeroes.
+func subtractContainers(dst, x, y []*Container) (neg *Container) {
+	var borrow *Container
+	for i := range dst {
+		a, b := x[i], y[i]
+		axb := xor(a, b)
+		dst[i] = xor(axb, borrow)
+		borrow = unionNil(difference(b, a), difference(borrow, axb))
+	}
+	// Negative columns hold the two's complement of their magnitude.
+	// Negating it keeps every bit up to and including the lowest set bit,
+	// and flips every bit above it.
+	var seen *Container
+	for i, d := range dst {
+		dst[i] = xor(d, intersect(seen, borrow))
+		seen = unionNil(seen, d)
+	}
+	return borrow
+}
+
+// unionNil is union, treating nil containers as empty.
+func unionNil(a, b *Container) *Container {
+	if a.N() == 0 {
+		return b
+	}
+	if b.N() == 0 {
+		return a
+	}
+	return union(a, b)
+}
+
+// bsiKeys returns the sorted container keys present in any of the given
+// slices.
+func bsiKeys(slices ...[]*Bitmap) []uint64 {
+	keys := NewBitmap()
+	for _, s := range slices {
+		for _, b := range s {
+			citer, _ := b.Containers.Iterator(0)
+			for citer.Next() {
+				k, c := citer.Value()
+				if c.N() != 0 {
+					keys.DirectAdd(k)
+				}
+			}
+			citer.Close()
+		}
+	}
+	return keys.Slice()
+}
+
+// maskSlices returns the slices restricted to the columns in mask, or to
+// the columns not in mask if exclude is set.
+func maskSlices(slices []*Bitmap, mask *Bitmap, exclude bool) []*Bitmap {
+	out := make([]*Bitmap, len(slices))
+	for i, s := range slices {
+		if exclude {
+			out[i] = s.Difference(mask)
+		} else {
+			out[i] = s.Intersect(mask)
+		}
+	}
+	return out
+}
+
+// Negate returns a BSI holding the negation of every value in b. The
+// result shares its containers with b.
+func (b *BSI) Negate() *BSI {
+	nonzero := NewBitmap().Union(b.Slices()...)
+	rows := make([]*Bitmap, len(b.rows))
+	for i, row := range b.rows {
+		rows[i] = row.Freeze()
+	}
+	rows[1] = nonzero.Difference(b.Sign())
+	return &BSI{rows: rows}
+}
+
+// Add returns the signed sum of b and o. Columns present in only one of
+// them are taken to be zero in the other.
+func (b *BSI) Add(o *BSI) *BSI {
+	// Columns with matching signs add magnitudes and keep their sign.
+	// Columns with mixed signs subtract magnitudes, and flip their sign
+	// when o's magnitude was larger.
+	mixed := b.Sign().Xor(o.Sign())
+	sum := Add(maskSlices(b.Slices(), mixed, true), maskSlices(o.Slices(), mixed, true))
+	diff, neg := Subtract(maskSlices(b.Slices(), mixed, false), maskSlices(o.Slices(), mixed, false))
+
+	slices := make([]*Bitmap, max(len(sum), len(diff)))
+	for i := range slices {
+		slices[i] = NewBitmap()
+		if i < len(sum) {
+			slices[i] = slices[i].Union(sum[i])
+		}
+		if i < len(diff) {
+			slices[i] = slices[i].Union(diff[i])
+		}
+	}
+	sign := b.Sign().Difference(mixed).Union(b.Sign().Intersect(mixed).Xor(neg))
+	// A zero sum has no sign.
+	sign = sign.Intersect(NewBitmap().Union(slices...))
+	return NewBSIFromRows(append([]*Bitmap{b.Existence().Union(o.Existence()), sign}, slices...))
+}
+
+// Subtract returns the signed difference b - o. Columns present in only
+// one of them are taken to be zero in the other.
+func (b *BSI) Subtract(o *BSI) *BSI {
+	return b.Add(o.Negate())
+}
+
+// RangeOp is a comparison evaluated against every column of a BSI.
+type RangeOp int
+
+const (
+	RangeLT RangeOp = iota
+	RangeLTE
+	RangeGT
+	RangeGTE
+	RangeEQ
+	RangeNEQ
+)
+
+// mirror returns the comparison which holds for -x and -v when op holds
+// for x and v.
+func (op RangeOp) mirror() RangeOp {
+	switch op {
+	case RangeLT:
+		return RangeGT
+	case RangeLTE:
+		return RangeGTE
+	case RangeGT:
+		return RangeLT
+	case RangeGTE:
+		return RangeLTE
+	}
+	return op
+}
+
+// Range returns the columns whose unsigned value in slices compares to v
+// according to op. Only columns in filter are considered; a nil filter
+// means every column with a non-zero value, since zero-valued columns
+// don't appear in the slices at all.
+//
+// This is O'Neil's range evaluation: for each container key it walks the
+// slices from the most significant bit down, narrowing the set of columns
+// still equal to v so far.
+func Range(slices []*Bitmap, op RangeOp, v uint64, filter *Bitmap) *Bitmap {
+	if filter == nil {
+		filter = NewBitmap().Union(slices...)
+	}
+	dst := NewBitmap()
+	citer, _ := filter.Containers.Iterator(0)
+	defer citer.Close()
+	for citer.Next() {
+		key, u := citer.Value()
+		if c := rangeContainer(slices, key, u, op, v); c.N() != 0 {
+			dst.Containers.Put(key, c.Freeze())
+		}
+	}
+	return dst
+}
+
+// RangeBetween returns the columns whose unsigned value in slices lies in
+// [lo, hi]. The filter behaves as it does for Range.
+func RangeBetween(slices []*Bitmap, lo, hi uint64, filter *Bitmap) *Bitmap {
+	if filter == nil {
+		filter = NewBitmap().Union(slices...)
+	}
+	dst := NewBitmap()
+	if lo > hi {
+		return dst
+	}
+	citer, _ := filter.Containers.Iterator(0)
+	defer citer.Close()
+	for citer.Next() {
+		key, u := citer.Value()
+		c := rangeContainer(slices, key, u, RangeGTE, lo)
+		if c = rangeContainer(slices, key, c, RangeLTE, hi); c.N() != 0 {
+			dst.Containers.Put(key, c.Freeze())
+		}
+	}
+	return dst
+}
+
+// rangeContainer evaluates op against v for the columns of u, within one
+// container key.
+func rangeContainer(slices []*Bitmap, key uint64, u *Container, op RangeOp, v uint64) *Container {
+	if u.N() == 0 {
+		return nil
+	}
+	eq := u
+	var lt, gt *Container
+	if bits.Len64(v) > len(slices) {
+		// v is larger than any value the slices can hold.
+		eq, lt = nil, u
+	}
+	for i := len(slices) - 1; i >= 0 && eq.N() != 0; i-- {
+		s := slices[i].Containers.Get(key)
+		if v&(1<<i) != 0 {
+			lt = unionNil(lt, difference(eq, s))
+			eq = intersect(eq, s)
+		} else {
+			gt = unionNil(gt, intersect(eq, s))
+			eq = difference(eq, s)
+		}
+	}
+	switch op {
+	case RangeLT:
+		return lt
+	case RangeLTE:
+		return unionNil(lt, eq)
+	case RangeGT:
+		return gt
+	case RangeGTE:
+		return unionNil(gt, eq)
+	case RangeEQ:
+		return eq
+	case RangeNEQ:
+		return difference(u, eq)
+	}
+	return nil
+}
+
+// split returns the non-negative and negative columns of b, limited to
+// filter if it isn't nil.
+func (b *BSI) split(filter *Bitmap) (pos, neg *Bitmap) {
+	u := b.Existence()
+	if filter != nil {
+		u = u.Intersect(filter)
+	}
+	neg = u.Intersect(b.Sign())
+	return u.Difference(neg), neg
+}
+
+// Compare returns the columns of b, limited to filter if it isn't nil,
+// whose value compares to v according to op.
+func (b *BSI) Compare(op RangeOp, v int64, filter *Bitmap) *Bitmap {
+	pos, neg := b.split(filter)
+	if v >= 0 {
+		// Every negative column is below v.
+		dst := Range(b.Slices(), op, uint64(v), pos)
+		switch op {
+		case RangeLT, RangeLTE, RangeNEQ:
+			dst = dst.Union(neg)
+		}
+		return dst
+	}
+	// Every non-negative column is above v, and negative columns compare
+	// with their magnitudes mirrored.
+	dst := Range(b.Slices(), op.mirror(), -uint64(v), neg)
+	switch op {
+	case RangeGT, RangeGTE, RangeNEQ:
+		dst = dst.Union(pos)
+	}
+	return dst
+}
+
+// LT returns the columns of b with a value less than v, limited to filter
+// if it isn't nil.
+func (b *BSI) LT(v int64, filter *Bitmap) *Bitmap {
+	return b.Compare(RangeLT, v, filter)
+}
+
+// LTE returns the columns of b with a value less than or equal to v,
+// limited to filter if it isn't nil.
+func (b *BSI) LTE(v int64, filter *Bitmap) *Bitmap {
+	return b.Compare(RangeLTE, v, filter)
+}
+
+// GT returns the columns of b with a value greater than v, limited to
+// filter if it isn't nil.
+func (b *BSI) GT(v int64, filter *Bitmap) *Bitmap {
+	return b.Compare(RangeGT, v, filter)
+}
+
+// GTE returns the columns of b with a value greater than or equal to v,
+// limited to filter if it isn't nil.
+func (b *BSI) GTE(v int64, filter *Bitmap) *Bitmap {
+	return b.Compare(RangeGTE, v, filter)
+}
+
+// EQ returns the columns of b with a value equal to v, limited to filter
+// if it isn't nil.
+func (b *BSI) EQ(v int64, filter *Bitmap) *Bitmap {
+	return b.Compare(RangeEQ, v, filter)
+}
+
+// NEQ returns the columns of b with a value other than v, limited to
+// filter if it isn't nil.
+func (b *BSI) NEQ(v int64, filter *Bitmap) *Bitmap {
+	return b.Compare(RangeNEQ, v, filter)
+}
+
+// Between returns the columns of b with a value in [lo, hi], limited to
+// filter if it isn't nil.
+func (b *BSI) Between(lo, hi int64, filter *Bitmap) *Bitmap {
+	if lo > hi {
+		return NewBitmap()
+	}
+	return b.GTE(lo, filter).Intersect(b.LTE(hi, filter))
+}
+
+// Max returns the largest value among the columns of b, limited to filter
+// if it isn't nil, along with the columns holding it. If there are no
+// such columns, ok is false.
+func (b *BSI) Max(filter *Bitmap) (v int64, cols *Bitmap, ok bool) {
+	pos, neg := b.split(filter)
+	if pos.Any() {
+		m, cols := extremeSlices(b.Slices(), pos, true)
+		return int64(m), cols, true
+	}
+	if neg.Any() {
+		m, cols := extremeSlices(b.Slices(), neg, false)
+		return -int64(m), cols, true
+	}
+	return 0, NewBitmap(), false
+}
+
+// Min returns the smallest value among the columns of b, limited to filter
+// if it isn't nil, along with the columns holding it. If there are no
+// such columns, ok is false.
+func (b *BSI) Min(filter *Bitmap) (v int64, cols *Bitmap, ok bool) {
+	pos, neg := b.split(filter)
+	if neg.Any() {
+		m, cols := extremeSlices(b.Slices(), neg, true)
+		return -int64(m), cols, true
+	}
+	if pos.Any() {
+		m, cols := extremeSlices(b.Slices(), pos, false)
+		return int64(m), cols, true
+	}
+	return 0, NewBitmap(), false
+}
+
+// TopK returns the k columns of b with the largest values, limited to
+// filter if it isn't nil. Ties at the cutoff are broken in favor of lower
+// column IDs. If fewer than k columns are considered, all of them are
+// returned.
+func (b *BSI) TopK(k uint64, filter *Bitmap) *Bitmap {
+	pos, neg := b.split(filter)
+	if n := pos.Count(); n < k {
+		// Every non-negative column makes it, and the negative columns
+		// closest to zero fill the rest.
+		return pos.Union(topKSlices(b.Slices(), neg, k-n, false))
+	}
+	return topKSlices(b.Slices(), pos, k, true)
+}
+
+// extremeSlices returns the largest (or smallest) unsigned value in slices
+// among the columns of cand, which must not be empty, and the columns
+// holding it. Each slice, from the most significant down, narrows the
+// candidates to those with the preferred bit whenever any have it.
+func extremeSlices(slices []*Bitmap, cand *Bitmap, largest bool) (uint64, *Bitmap) {
+	var v uint64
+	for i := len(slices) - 1; i >= 0; i-- {
+		var next *Bitmap
+		if largest {
+			next = cand.Intersect(slices[i])
+		} else {
+			next = cand.Difference(slices[i])
+		}
+		if next.Any() {
+			cand = next
+			if largest {
+				v |= 1 << i
+			}
+		} else if !largest {
+			v |= 1 << i
+		}
+	}
+	return v, cand
+}
+
+// topKSlices returns the k columns of cand with the largest (or smallest)
+// unsigned values in slices. At each slice, from the most significant
+// down, the columns still tied either all make the cut, or are narrowed
+// to those with the preferred bit.
+func topKSlices(slices []*Bitmap, cand *Bitmap, k uint64, largest bool) *Bitmap {
+	dst := NewBitmap()
+	if k == 0 {
+		return dst
+	}
+	n := uint64(0)
+	for i := len(slices) - 1; i >= 0 && cand.Any(); i-- {
+		var ahead *Bitmap
+		if largest {
+			ahead = cand.Intersect(slices[i])
+		} else {
+			ahead = cand.Difference(slices[i])
+		}
+		an := ahead.Count()
+		if n+an > k {
+			cand = ahead
+			continue
+		}
+		dst = dst.Union(ahead)
+		n += an
+		if n == k {
+			return dst
+		}
+		cand = cand.Difference(ahead)
+	}
+	// What's left of cand is tied on every bit.
+	itr := cand.Iterator()
+	for ; n < k; n++ {
+		v, eof := itr.Next()
+		if eof {
+			break
+		}
+		dst.DirectAdd(v)
+	}
+	return dst
+}
+
+// AddConstant adds c to the unsigned value of every column in exists, using
+// Add with a constant BSI whose set bits are all of exists. Columns outside
+// exists are left out of the result unless they have a non-zero value in x.
+func AddConstant(x []*Bitmap, c uint64, exists *Bitmap) []*Bitmap {
+	y := make([]*Bitmap, bits.Len64(c))
+	for i := range y {
+		if c&(1<<i) != 0 {
+			y[i] = exists
+		} else {
+			y[i] = NewBitmap()
+		}
+	}
+	return Add(x, y)
+}
+
+// MultiplyConstant multiplies every unsigned value in x by c, by shifting
+// x once for each bit set in c and summing the shifted copies with Add.
+func MultiplyConstant(x []*Bitmap, c uint64) []*Bitmap {
+	var dst []*Bitmap
+	for c != 0 {
+		i := bits.TrailingZeros64(c)
+		c &^= 1 << i
+		dst = Add(dst, ScaleShift(x, i))
+	}
+	return dst
+}
+
+// ScaleShift multiplies every unsigned value in x by 2**n, or divides it
+// by 2**-n, discarding the remainder, if n is negative. Only the order of
+// the slices changes; the result shares containers with x.
+func ScaleShift(x []*Bitmap, n int) []*Bitmap {
+	if n < 0 {
+		if -n >= len(x) {
+			return nil
+		}
+		x, n = x[-n:], 0
+	}
+	dst := make([]*Bitmap, n, n+len(x))
+	for i := range dst {
+		dst[i] = NewBitmap()
+	}
+	for _, s := range x {
+		dst = append(dst, s.Freeze())
+	}
+	return dst
+}
+
+// AddConstant returns a BSI holding every value of b plus c.
+func (b *BSI) AddConstant(c int64) *BSI {
+	mag := uint64(c)
+	if c < 0 {
+		mag = -mag
+	}
+	exists := b.Existence()
+	rows := []*Bitmap{exists, NewBitmap()}
+	if c < 0 {
+		rows[1] = exists
+	}
+	for i := 0; i < bits.Len64(mag); i++ {
+		if mag&(1<<i) != 0 {
+			rows = append(rows, exists)
+		} else {
+			rows = append(rows, NewBitmap())
+		}
+	}
+	return b.Add(NewBSIFromRows(rows))
+}
+
+// MultiplyConstant returns a BSI holding every value of b times c.
+func (b *BSI) MultiplyConstant(c int64) *BSI {
+	mag := uint64(c)
+	if c < 0 {
+		mag = -mag
+	}
+	return b.withSlices(MultiplyConstant(b.Slices(), mag), c < 0)
+}
+
+// ScaleShift returns a BSI holding every value of b multiplied by 2**n, or
+// divided by 2**-n, truncating toward zero, if n is negative.
+func (b *BSI) ScaleShift(n int) *BSI {
+	return b.withSlices(ScaleShift(b.Slices(), n), false)
+}
+
+// withSlices returns a BSI with the existence of b and the given magnitude
+// slices, keeping the signs of b, or flipping them if negate is set. Zero
+// values lose their sign.
+func (b *BSI) withSlices(slices []*Bitmap, negate bool) *BSI {
+	nonzero := NewBitmap().Union(slices...)
+	sign := b.Sign().Intersect(nonzero)
+	if negate {
+		sign = nonzero.Difference(sign)
+	}
+	return NewBSIFromRows(append([]*Bitmap{b.Existence().Freeze(), sign}, slices...))
+}
+
+// BSIBucket is the number of columns whose value falls in the bucket
+// starting at Start, as reported by BSI.GroupCount.
+type BSIBucket struct {
+	Start int64
+	Count uint64
+}
+
+// GroupCount returns the number of columns of b, limited to filter if it
+// isn't nil, in each bucket of values [k*bucketWidth, (k+1)*bucketWidth).
+// Buckets are in ascending order, and empty buckets are omitted. A
+// bucketWidth below 1 is treated as 1, giving a count per distinct value.
+func (b *BSI) GroupCount(filter *Bitmap, bucketWidth int64) []BSIBucket {
+	bucketWidth = max(bucketWidth, 1)
+	pos, neg := b.split(filter)
+
+	var groups []BSIBucket
+	add := func(v int64, n uint64) {
+		start := v / bucketWidth
+		if v%bucketWidth != 0 && v < 0 {
+			start--
+		}
+		start *= bucketWidth
+		if len(groups) > 0 && groups[len(groups)-1].Start == start {
+			groups[len(groups)-1].Count += n
+			return
+		}
+		groups = append(groups, BSIBucket{Start: start, Count: n})
+	}
+	// Magnitudes are walked in ascending order, so negative values come
+	// out in descending order.
+	var negs []BSIBucket
+	walkSlices(b.Slices(), neg, 0, func(mag, n uint64) {
+		negs = append(negs, BSIBucket{Start: -int64(mag), Count: n})
+	})
+	for i := len(negs) - 1; i >= 0; i-- {
+		add(negs[i].Start, negs[i].Count)
+	}
+	// Buckets of non-negative values line up with the low bits when the
+	// width is a power of two, so the walk can stop early.
+	stop := 0
+	if bucketWidth&(bucketWidth-1) == 0 {
+		stop = bits.TrailingZeros64(uint64(bucketWidth))
+	}
+	walkSlices(b.Slices(), pos, stop, func(mag, n uint64) {
+		add(int64(mag), n)
+	})
+	return groups
+}
+
+// DistinctCount returns the number of distinct values among the columns of
+// b, limited to filter if it isn't nil.
+func (b *BSI) DistinctCount(filter *Bitmap) uint64 {
+	pos, neg := b.split(filter)
+	var n uint64
+	count := func(uint64, uint64) { n++ }
+	walkSlices(b.Slices(), pos, 0, count)
+	walkSlices(b.Slices(), neg, 0, count)
+	return n
+}
+
+// walkSlices calls fn, in ascending order, for each distinct unsigned value
+// in slices among the columns of cand, ignoring the lowest stop bits, with
+// the value and the number of columns holding it. It splits cand on each
+// slice from the most significant down, using intersection counts to skip
+// splits which would leave one side empty.
+func walkSlices(slices []*Bitmap, cand *Bitmap, stop int, fn func(v, n uint64)) {
+	if n := cand.Count(); n != 0 {
+		walkSlicesFrom(slices, cand, n, len(slices)-1, stop, 0, fn)
+	}
+}
+
+func walkSlicesFrom(slices []*Bitmap, cand *Bitmap, n uint64, i, stop int, prefix uint64, fn func(v, n uint64)) {
+	for ; i >= stop; i-- {
+		ones := cand.IntersectionCount(slices[i])
+		switch ones {
+		case 0:
+			continue
+		case n:
+			prefix |= 1 << i
+			continue
+		}
+		walkSlicesFrom(slices, cand.Difference(slices[i]), n-ones, i-1, stop, prefix, fn)
+		walkSlicesFrom(slices, cand.Intersect(slices[i]), ones, i-1, stop, prefix|1<<i, fn)
+		return
+	}
+	fn(prefix, n)
+}
+
+// BSIFromValues builds a BSI holding vals[i] for cols[i]. The two slices
+// must be the same length. If a column appears more than once, its last
+// value wins. Rather than setting values one column at a time, it collects
+// the low bits of each row for a container key and builds each row's
+// container from them at once.
+func BSIFromValues(cols []uint64, vals []int64) *BSI {
+	order := make([]int, len(cols))
+	depth := 0
+	for i := range order {
+		order[i] = i
+		mag := uint64(vals[i])
+		if vals[i] < 0 {
+			mag = -mag
+		}
+		depth = max(depth, bits.Len64(mag))
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(cols[a], cols[b])
+	})
+
+	rows := make([]*Bitmap, depth+2)
+	for i := range rows {
+		rows[i] = NewBitmap()
+	}
+	// Columns arrive in order, so each row's low bits are sorted.
+	lows := make([][]uint16, len(rows))
+	flush := func(key uint64) {
+		for r, a := range lows {
+			if len(a) == 0 {
+				continue
+			}
+			var c *Container
+			if len(a) <= ArrayMaxSize {
+				c = NewContainerArrayCopy(a)
+			} else {
+				bitmap := make([]uint64, bitmapN)
+				for _, low := range a {
+					bitmap[low/64] |= 1 << (low % 64)
+				}
+				c = NewContainerBitmapN(bitmap, int32(len(a)))
+			}
+			rows[r].Containers.Put(key, c.Optimize())
+			lows[r] = a[:0]
+		}
+	}
+	set := func(r int, low uint16) {
+		lows[r] = append(lows[r], low)
+	}
+
+	key := ^uint64(0)
+	for i, idx := range order {
+		col := cols[idx]
+		if i+1 < len(order) && cols[order[i+1]] == col {
+			continue
+		}
+		if highbits(col) != key {
+			flush(key)
+			key = highbits(col)
+		}
+		low := lowbits(col)
+		v := vals[idx]
+		mag := uint64(v)
+		set(0, low)
+		if v < 0 {
+			mag = -mag
+			set(1, low)
+		}
+		for mag != 0 {
+			j := bits.TrailingZeros64(mag)
+			mag &^= 1 << j
+			set(j+2, low)
+		}
+	}
+	flush(key)
+	return &BSI{rows: rows}
+}
+
+// Values returns the columns of b, limited to filter if it isn't nil, in
+// ascending order, along with their values. Each row is read a container
+// at a time and spread into the values of the columns it covers.
+func (b *BSI) Values(filter *Bitmap) (cols []uint64, vals []int64) {
+	u := b.Existence()
+	if filter != nil {
+		u = u.Intersect(filter)
+	}
+	n := u.Count()
+	cols, vals = make([]uint64, 0, n), make([]int64, 0, n)
+	var mags, neg []uint64
+	citer, _ := u.Containers.Iterator(0)
+	defer citer.Close()
+	for citer.Next() {
+		key, uc := citer.Value()
+		lows := uc.Slice()
+		mags = append(mags[:0], make([]uint64, len(lows))...)
+		neg = append(neg[:0], make([]uint64, len(lows))...)
+		// spread sets bit in dst for every column of the container
+		// present in c.
+		spread := func(dst []uint64, c *Container, bit uint64) {
+			j := 0
+			for _, low := range intersect(uc, c).Slice() {
+				for lows[j] != low {
+					j++
+				}
+				dst[j] |= bit
+			}
+		}
+		for i, row := range b.Slices() {
+			spread(mags, row.Containers.Get(key), 1<<i)
+		}
+		spread(neg, b.Sign().Containers.Get(key), 1)
+		for j, low := range lows {
+			cols = append(cols, key<<16|uint64(low))
+			if neg[j] != 0 {
+				vals = append(vals, -int64(mags[j]))
+			} else {
+				vals = append(vals, int64(mags[j]))
+			}
+		}
+	}
+	return cols, vals
+}
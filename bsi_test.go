@@ -0,0 +1,596 @@
+// Copyright 2022 Molecula Corp. (DBA FeatureBase).
+// SPDX-License-Identifier: Apache-2.0
+package roaring
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/gernest/roaring/shardwidth"
+)
+
+// randomBSI populates a BSI with n random values, spread over a few
+// containers, returning the expected column values.
+func randomBSI(rnd *rand.Rand, n int, base uint64, signed bool, maxVal int64) (*BSI, map[uint64]int64) {
+	b := NewBSI()
+	vals := make(map[uint64]int64, n)
+	for i := 0; i < n; i++ {
+		col := base + uint64(rnd.Intn(4<<16))
+		v := rnd.Int63n(maxVal)
+		if signed && rnd.Intn(2) == 0 {
+			v = -v
+		}
+		b.SetValue(col, v)
+		vals[col] = v
+	}
+	return b, vals
+}
+
+// checkBSI verifies that b holds exactly the values in vals.
+func checkBSI(t *testing.T, b *BSI, vals map[uint64]int64) {
+	t.Helper()
+	if got, want := b.Existence().Count(), uint64(len(vals)); got != want {
+		t.Fatalf("existence count: expected %d, got %d", want, got)
+	}
+	for col, want := range vals {
+		got, ok := b.Value(col)
+		if !ok || got != want {
+			t.Fatalf("column %d: expected %d, got %d (exists %t)", col, want, got, ok)
+		}
+	}
+}
+
+func TestBSI_SetValue(t *testing.T) {
+	b := NewBSI()
+	if b.BitDepth() != 0 {
+		t.Fatalf("empty BSI has depth %d", b.BitDepth())
+	}
+	edges := map[uint64]int64{
+		0:          0,
+		1:          1,
+		2:          -1,
+		65535:      math.MaxInt64,
+		65536:      math.MinInt64,
+		1 << 40:    -12345,
+		1<<40 + 1:  12345,
+		^uint64(0): 7,
+	}
+	for col, v := range edges {
+		b.SetValue(col, v)
+	}
+	if b.BitDepth() != 64 {
+		t.Fatalf("expected depth 64, got %d", b.BitDepth())
+	}
+	checkBSI(t, b, edges)
+
+	// Overwriting must clear bits and the sign.
+	b.SetValue(65536, 2)
+	b.SetValue(2, 0)
+	edges[65536], edges[2] = 2, 0
+	checkBSI(t, b, edges)
+
+	b.ClearValue(1 << 40)
+	delete(edges, 1<<40)
+	checkBSI(t, b, edges)
+	if _, ok := b.Value(1 << 40); ok {
+		t.Fatal("cleared value still present")
+	}
+	if _, ok := b.Value(3); ok {
+		t.Fatal("unset column has a value")
+	}
+
+	rnd := rand.New(rand.NewSource(11))
+	r, vals := randomBSI(rnd, 5000, 0, true, math.MaxInt64)
+	checkBSI(t, r, vals)
+	for col := range vals {
+		if rnd.Intn(3) == 0 {
+			r.ClearValue(col)
+			delete(vals, col)
+		}
+	}
+	checkBSI(t, r, vals)
+}
+
+func TestBSI_Add(t *testing.T) {
+	rnd := rand.New(rand.NewSource(12))
+	x, xvals := randomBSI(rnd, 3000, 0, false, 1<<40)
+	y, yvals := randomBSI(rnd, 3000, 1<<16, false, 1<<20)
+
+	want := make(map[uint64]int64, len(xvals)+len(yvals))
+	for col, v := range xvals {
+		want[col] += v
+	}
+	for col, v := range yvals {
+		want[col] += v
+	}
+	sum := NewBSIFromSlices(x.Existence().Union(y.Existence()), Add(x.Slices(), y.Slices()))
+	checkBSI(t, sum, want)
+
+	// Without an explicit existence row, zero-valued columns drop out.
+	z := NewBSIFromSlices(nil, sum.Slices())
+	for col, v := range want {
+		if v == 0 {
+			delete(want, col)
+		}
+	}
+	checkBSI(t, z, want)
+}
+
+func TestBSI_Fragment(t *testing.T) {
+	const shard = 3
+	rnd := rand.New(rand.NewSource(13))
+	b, vals := randomBSI(rnd, 2000, shard*shardwidth.ShardWidth, true, 1<<30)
+	// Columns outside the shard are not part of its fragment.
+	b.SetValue(0, 5)
+	b.SetValue((shard+1)*shardwidth.ShardWidth, 5)
+
+	frag := b.Fragment(shard)
+	var wantSum int64
+	for _, v := range vals {
+		wantSum += v
+	}
+	filter := NewBitmapBSICountFilter(nil)
+	iter, _ := frag.Containers.Iterator(0)
+	if err := ApplyFilterToIterator(filter, iter); err != nil {
+		t.Fatal(err)
+	}
+	count, total := filter.Total()
+	if int(count) != len(vals) || total != wantSum {
+		t.Fatalf("expected count %d sum %d, got count %d sum %d", len(vals), wantSum, count, total)
+	}
+
+	checkBSI(t, NewBSIFromFragment(shard, frag), vals)
+}
+
+func TestSubtract(t *testing.T) {
+	rnd := rand.New(rand.NewSource(14))
+	x, xvals := randomBSI(rnd, 3000, 0, false, 1<<40)
+	y, yvals := randomBSI(rnd, 3000, 1<<16, false, 1<<40)
+	// Equal values must come out as a zero with no sign.
+	for col, v := range xvals {
+		if rnd.Intn(10) == 0 {
+			y.SetValue(col, v)
+			yvals[col] = v
+		}
+	}
+
+	want := make(map[uint64]int64, len(xvals)+len(yvals))
+	for col, v := range xvals {
+		want[col] += v
+	}
+	for col, v := range yvals {
+		want[col] -= v
+	}
+	diff, neg := Subtract(x.Slices(), y.Slices())
+	got := NewBSIFromRows(append([]*Bitmap{x.Existence().Union(y.Existence()), neg}, diff...))
+	checkBSI(t, got, want)
+	for col, v := range want {
+		if neg.Contains(col) != (v < 0) {
+			t.Fatalf("column %d: value %d but sign %t", col, v, neg.Contains(col))
+		}
+	}
+}
+
+func TestBSI_SignedArithmetic(t *testing.T) {
+	rnd := rand.New(rand.NewSource(15))
+	x, xvals := randomBSI(rnd, 3000, 0, true, 1<<40)
+	y, yvals := randomBSI(rnd, 3000, 1<<16, true, 1<<40)
+	for col, v := range xvals {
+		switch rnd.Intn(10) {
+		case 0:
+			y.SetValue(col, v)
+			yvals[col] = v
+		case 1:
+			y.SetValue(col, -v)
+			yvals[col] = -v
+		}
+	}
+
+	neg := make(map[uint64]int64, len(xvals))
+	for col, v := range xvals {
+		neg[col] = -v
+	}
+	checkBSI(t, x.Negate(), neg)
+	checkBSI(t, x.Negate().Negate(), xvals)
+
+	sum := make(map[uint64]int64, len(xvals)+len(yvals))
+	diff := make(map[uint64]int64, len(xvals)+len(yvals))
+	for col, v := range xvals {
+		sum[col] += v
+		diff[col] += v
+	}
+	for col, v := range yvals {
+		sum[col] += v
+		diff[col] -= v
+	}
+	gotSum, gotDiff := x.Add(y), x.Subtract(y)
+	checkBSI(t, gotSum, sum)
+	checkBSI(t, gotDiff, diff)
+	for _, b := range []*BSI{gotSum, gotDiff} {
+		if !b.Sign().IsSubsetOf(NewBitmap().Union(b.Slices()...)) {
+			t.Fatal("sign set on a zero value")
+		}
+	}
+
+	// The inputs are unchanged.
+	checkBSI(t, x, xvals)
+	checkBSI(t, y, yvals)
+}
+
+func TestBSI_Compare(t *testing.T) {
+	rnd := rand.New(rand.NewSource(16))
+	b, vals := randomBSI(rnd, 4000, 0, true, 64)
+	for col := range vals {
+		if rnd.Intn(20) == 0 {
+			b.SetValue(col, math.MinInt64+1)
+			vals[col] = math.MinInt64 + 1
+		}
+	}
+	filter := NewBitmap()
+	for col := range vals {
+		if rnd.Intn(2) == 0 {
+			filter.DirectAdd(col)
+		}
+	}
+	filter.DirectAdd(1 << 30) // not in b
+
+	ops := []struct {
+		op   RangeOp
+		name string
+		fn   func(x, v int64) bool
+	}{
+		{RangeLT, "LT", func(x, v int64) bool { return x < v }},
+		{RangeLTE, "LTE", func(x, v int64) bool { return x <= v }},
+		{RangeGT, "GT", func(x, v int64) bool { return x > v }},
+		{RangeGTE, "GTE", func(x, v int64) bool { return x >= v }},
+		{RangeEQ, "EQ", func(x, v int64) bool { return x == v }},
+		{RangeNEQ, "NEQ", func(x, v int64) bool { return x != v }},
+	}
+	check := func(t *testing.T, got *Bitmap, filter *Bitmap, fn func(x int64) bool) {
+		t.Helper()
+		want := NewBitmap()
+		for col, x := range vals {
+			if (filter == nil || filter.Contains(col)) && fn(x) {
+				want.DirectAdd(col)
+			}
+		}
+		if got.Compare(want) != 0 {
+			t.Fatalf("expected %d columns, got %d", want.Count(), got.Count())
+		}
+	}
+	for _, v := range []int64{0, 1, -1, 17, -17, 63, -63, 64, -64, 1000, math.MaxInt64, math.MinInt64, math.MinInt64 + 1} {
+		for _, op := range ops {
+			t.Run(fmt.Sprintf("%s/%d", op.name, v), func(t *testing.T) {
+				fn := func(x int64) bool { return op.fn(x, v) }
+				check(t, b.Compare(op.op, v, nil), nil, fn)
+				check(t, b.Compare(op.op, v, filter), filter, fn)
+			})
+		}
+	}
+	for _, r := range [][2]int64{{-10, 10}, {0, 0}, {5, 40}, {-40, -5}, {10, -10}, {math.MinInt64, 0}} {
+		lo, hi := r[0], r[1]
+		fn := func(x int64) bool { return lo <= x && x <= hi }
+		check(t, b.Between(lo, hi, nil), nil, fn)
+		check(t, b.Between(lo, hi, filter), filter, fn)
+	}
+	check(t, b.LT(3, nil), nil, func(x int64) bool { return x < 3 })
+	check(t, b.GTE(-3, filter), filter, func(x int64) bool { return x >= -3 })
+	check(t, b.EQ(7, nil), nil, func(x int64) bool { return x == 7 })
+}
+
+func TestRange(t *testing.T) {
+	rnd := rand.New(rand.NewSource(17))
+	b, vals := randomBSI(rnd, 4000, 0, false, 100)
+	// A nil filter only sees non-zero columns.
+	got := Range(b.Slices(), RangeLT, 10, nil)
+	want := NewBitmap()
+	for col, x := range vals {
+		if x != 0 && x < 10 {
+			want.DirectAdd(col)
+		}
+	}
+	if got.Compare(want) != 0 {
+		t.Fatalf("LT: expected %d columns, got %d", want.Count(), got.Count())
+	}
+	got = RangeBetween(b.Slices(), 0, 20, b.Existence())
+	want = NewBitmap()
+	for col, x := range vals {
+		if x <= 20 {
+			want.DirectAdd(col)
+		}
+	}
+	if got.Compare(want) != 0 {
+		t.Fatalf("Between: expected %d columns, got %d", want.Count(), got.Count())
+	}
+}
+
+// bruteMinMax returns the extreme values among vals limited to filter, and
+// the columns holding them.
+func bruteMinMax(vals map[uint64]int64, filter *Bitmap) (lo, hi int64, los, his *Bitmap) {
+	los, his = NewBitmap(), NewBitmap()
+	lo, hi = math.MaxInt64, math.MinInt64
+	for col, v := range vals {
+		if filter != nil && !filter.Contains(col) {
+			continue
+		}
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	for col, v := range vals {
+		if filter != nil && !filter.Contains(col) {
+			continue
+		}
+		if v == lo {
+			los.DirectAdd(col)
+		}
+		if v == hi {
+			his.DirectAdd(col)
+		}
+	}
+	return lo, hi, los, his
+}
+
+// bruteTopK returns the k columns with the largest values, breaking ties
+// by lower column.
+func bruteTopK(vals map[uint64]int64, filter *Bitmap, k int) *Bitmap {
+	cols := make([]uint64, 0, len(vals))
+	for col := range vals {
+		if filter == nil || filter.Contains(col) {
+			cols = append(cols, col)
+		}
+	}
+	slices.SortFunc(cols, func(a, b uint64) int {
+		if c := cmp.Compare(vals[b], vals[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	return NewBitmap(cols[:min(k, len(cols))]...)
+}
+
+func TestBSI_MinMaxTopK(t *testing.T) {
+	rnd := rand.New(rand.NewSource(18))
+	for _, signed := range []bool{false, true} {
+		b, vals := randomBSI(rnd, 3000, 0, signed, 200)
+		filter := NewBitmap()
+		for col := range vals {
+			if rnd.Intn(3) == 0 {
+				filter.DirectAdd(col)
+			}
+		}
+		for _, f := range []*Bitmap{nil, filter} {
+			lo, hi, los, his := bruteMinMax(vals, f)
+			v, cols, ok := b.Min(f)
+			if !ok || v != lo || cols.Compare(los) != 0 {
+				t.Fatalf("min: expected %d on %d columns, got %d on %d columns", lo, los.Count(), v, cols.Count())
+			}
+			v, cols, ok = b.Max(f)
+			if !ok || v != hi || cols.Compare(his) != 0 {
+				t.Fatalf("max: expected %d on %d columns, got %d on %d columns", hi, his.Count(), v, cols.Count())
+			}
+			for _, k := range []int{0, 1, 10, 100, 999, len(vals) + 1} {
+				want := bruteTopK(vals, f, k)
+				if got := b.TopK(uint64(k), f); got.Compare(want) != 0 {
+					t.Fatalf("top %d (signed %t): expected %d columns, got %d", k, signed, want.Count(), got.Count())
+				}
+			}
+		}
+	}
+
+	empty := NewBSI()
+	if _, _, ok := empty.Min(nil); ok {
+		t.Fatal("min of empty BSI")
+	}
+	if _, _, ok := empty.Max(nil); ok {
+		t.Fatal("max of empty BSI")
+	}
+	if empty.TopK(3, nil).Any() {
+		t.Fatal("top k of empty BSI")
+	}
+}
+
+func TestBitmapBSIMinMaxTopKFilter(t *testing.T) {
+	const shard = 2
+	base := uint64(shard * shardwidth.ShardWidth)
+	rnd := rand.New(rand.NewSource(19))
+	b, vals := randomBSI(rnd, 3000, base, true, 500)
+	filter := NewBitmap()
+	for col := range vals {
+		if rnd.Intn(2) == 0 {
+			filter.DirectAdd(col)
+		}
+	}
+	frag := b.Fragment(shard)
+	// Filters in fragment layout take the shard-relative filter.
+	rel := NewBitmap()
+	for _, col := range filter.Slice() {
+		rel.DirectAdd(col - base)
+	}
+	shift := func(cols *Bitmap) *Bitmap {
+		out := NewBitmap()
+		for _, col := range cols.Slice() {
+			out.DirectAdd(col - base)
+		}
+		return out
+	}
+
+	for _, f := range []*Bitmap{nil, filter} {
+		var ff *Bitmap
+		if f != nil {
+			ff = rel
+		}
+		minF, maxF, topF := NewBitmapBSIMinFilter(ff), NewBitmapBSIMaxFilter(ff), NewBitmapBSITopKFilter(ff, 50)
+		for _, bf := range []BitmapFilter{minF, maxF, topF} {
+			iter, _ := frag.Containers.Iterator(0)
+			if err := ApplyFilterToIterator(bf, iter); err != nil {
+				t.Fatal(err)
+			}
+		}
+		wantV, wantCols, _ := b.Min(f)
+		if v, cols, ok := minF.Min(); !ok || v != wantV || cols.Compare(shift(wantCols)) != 0 {
+			t.Fatalf("min filter: expected %d, got %d (ok %t)", wantV, v, ok)
+		}
+		wantV, wantCols, _ = b.Max(f)
+		if v, cols, ok := maxF.Max(); !ok || v != wantV || cols.Compare(shift(wantCols)) != 0 {
+			t.Fatalf("max filter: expected %d, got %d (ok %t)", wantV, v, ok)
+		}
+		if got, want := topF.TopK(), shift(b.TopK(50, f)); got.Compare(want) != 0 {
+			t.Fatalf("top k filter: expected %v, got %v", want.Slice(), got.Slice())
+		}
+	}
+}
+
+func TestBSI_ScalarOps(t *testing.T) {
+	rnd := rand.New(rand.NewSource(20))
+	x, xvals := randomBSI(rnd, 3000, 0, false, 1<<30)
+	x.SetValue(1<<20, 0)
+	xvals[1<<20] = 0
+
+	mapVals := func(vals map[uint64]int64, fn func(int64) int64) map[uint64]int64 {
+		out := make(map[uint64]int64, len(vals))
+		for col, v := range vals {
+			out[col] = fn(v)
+		}
+		return out
+	}
+	unsigned := func(slices []*Bitmap) *BSI {
+		return NewBSIFromSlices(x.Existence(), slices)
+	}
+	checkBSI(t, unsigned(AddConstant(x.Slices(), 12345, x.Existence())), mapVals(xvals, func(v int64) int64 { return v + 12345 }))
+	checkBSI(t, unsigned(AddConstant(x.Slices(), 0, x.Existence())), xvals)
+	for _, c := range []uint64{0, 1, 2, 10, 255, 1000003} {
+		checkBSI(t, unsigned(MultiplyConstant(x.Slices(), c)), mapVals(xvals, func(v int64) int64 { return v * int64(c) }))
+	}
+	for _, n := range []int{0, 3, -3, -40} {
+		checkBSI(t, unsigned(ScaleShift(x.Slices(), n)), mapVals(xvals, func(v int64) int64 {
+			if n < 0 {
+				return v >> -n
+			}
+			return v << n
+		}))
+	}
+
+	s, svals := randomBSI(rnd, 3000, 0, true, 1<<30)
+	for _, c := range []int64{0, 7, -7, 1 << 31, -(1 << 31)} {
+		checkBSI(t, s.AddConstant(c), mapVals(svals, func(v int64) int64 { return v + c }))
+		checkBSI(t, s.MultiplyConstant(c), mapVals(svals, func(v int64) int64 { return v * c }))
+	}
+	for _, n := range []int{0, 5, -5, -31} {
+		checkBSI(t, s.ScaleShift(n), mapVals(svals, func(v int64) int64 {
+			if n < 0 {
+				return v / (1 << -n)
+			}
+			return v << n
+		}))
+	}
+	checkBSI(t, s, svals)
+}
+
+func TestBSI_GroupCount(t *testing.T) {
+	rnd := rand.New(rand.NewSource(21))
+	b, vals := randomBSI(rnd, 3000, 0, true, 300)
+	filter := NewBitmap()
+	for col := range vals {
+		if rnd.Intn(2) == 0 {
+			filter.DirectAdd(col)
+		}
+	}
+	for _, f := range []*Bitmap{nil, filter} {
+		for _, width := range []int64{0, 1, 2, 7, 16, 100, 1 << 20} {
+			counts := map[int64]uint64{}
+			distinct := map[int64]struct{}{}
+			for col, v := range vals {
+				if f != nil && !f.Contains(col) {
+					continue
+				}
+				w := max(width, 1)
+				start := v / w
+				if v%w != 0 && v < 0 {
+					start--
+				}
+				counts[start*w]++
+				distinct[v] = struct{}{}
+			}
+			want := make([]BSIBucket, 0, len(counts))
+			for start, n := range counts {
+				want = append(want, BSIBucket{Start: start, Count: n})
+			}
+			slices.SortFunc(want, func(a, b BSIBucket) int { return cmp.Compare(a.Start, b.Start) })
+			if got := b.GroupCount(f, width); !slices.Equal(got, want) {
+				t.Fatalf("width %d: expected %v, got %v", width, want, got)
+			}
+			if got := b.DistinctCount(f); got != uint64(len(distinct)) {
+				t.Fatalf("expected %d distinct values, got %d", len(distinct), got)
+			}
+		}
+	}
+	if got := NewBSI().GroupCount(nil, 10); len(got) != 0 {
+		t.Fatalf("empty BSI has groups %v", got)
+	}
+}
+
+func TestBSIFromValues(t *testing.T) {
+	rnd := rand.New(rand.NewSource(22))
+	var cols []uint64
+	var vals []int64
+	want := map[uint64]int64{}
+	for i := 0; i < 20000; i++ {
+		// Dense runs in one container, sparse values elsewhere.
+		col := uint64(rnd.Intn(1 << 16))
+		if i%2 == 0 {
+			col = uint64(rnd.Int63n(1 << 40))
+		}
+		v := rnd.Int63n(1<<20) - 1<<19
+		cols, vals = append(cols, col), append(vals, v)
+		want[col] = v
+	}
+	cols, vals = append(cols, 7, 8, 9), append(vals, math.MinInt64, math.MaxInt64, 0)
+	want[7], want[8], want[9] = math.MinInt64, math.MaxInt64, 0
+
+	b := BSIFromValues(cols, vals)
+	checkBSI(t, b, want)
+	ref := NewBSI()
+	for i, col := range cols {
+		ref.SetValue(col, vals[i])
+	}
+	if b.BitDepth() != ref.BitDepth() {
+		t.Fatalf("expected depth %d, got %d", ref.BitDepth(), b.BitDepth())
+	}
+	for i, row := range ref.Rows() {
+		if row.Compare(b.Rows()[i]) != 0 {
+			t.Fatalf("row %d differs", i)
+		}
+	}
+
+	filter := NewBitmap()
+	for col := range want {
+		if rnd.Intn(2) == 0 {
+			filter.DirectAdd(col)
+		}
+	}
+	for _, f := range []*Bitmap{nil, filter} {
+		gotCols, gotVals := b.Values(f)
+		wantCols := make([]uint64, 0, len(want))
+		for col := range want {
+			if f == nil || f.Contains(col) {
+				wantCols = append(wantCols, col)
+			}
+		}
+		slices.Sort(wantCols)
+		if !slices.Equal(gotCols, wantCols) {
+			t.Fatalf("expected %d columns, got %d", len(wantCols), len(gotCols))
+		}
+		for i, col := range gotCols {
+			if gotVals[i] != want[col] {
+				t.Fatalf("column %d: expected %d, got %d", col, want[col], gotVals[i])
+			}
+		}
+	}
+
+	if empty := BSIFromValues(nil, nil); empty.Existence().Any() || empty.BitDepth() != 0 {
+		t.Fatal("expected an empty BSI")
+	}
+}
@@ -4,8 +4,17 @@ package roaring
 
 import "slices"
 
+// mapContainers stores containers in a map, along with a sorted index of
+// the keys for ordered access. The index is kept up to date cheaply while
+// keys arrive in ascending order or leave from the end, and otherwise is
+// marked stale and rebuilt by the next ordered access.
 type mapContainers struct {
 	data map[uint64]*Container
+	// keys holds every key in data, in order, unless stale is set. It is
+	// never modified in place once iterators may hold it, only appended
+	// to or replaced.
+	keys  []uint64
+	stale bool
 }
 
 func newMapContainers() *mapContainers {
@@ -32,11 +41,47 @@ func (btc *mapContainers) Get(key uint64) *Container {
 }
 
 func (btc *mapContainers) Put(key uint64, c *Container) {
+	if _, ok := btc.data[key]; !ok {
+		btc.added(key)
+	}
 	btc.data[key] = c
 }
 
 func (btc *mapContainers) Remove(key uint64) {
+	if _, ok := btc.data[key]; !ok {
+		return
+	}
 	delete(btc.data, key)
+	if n := len(btc.keys) - 1; !btc.stale && btc.keys[n] == key {
+		// Limit the capacity so a later append can't overwrite the
+		// key in a snapshot an iterator is still using.
+		btc.keys = btc.keys[:n:n]
+	} else {
+		btc.stale = true
+	}
+}
+
+// added updates the key index for a key new to data.
+func (btc *mapContainers) added(key uint64) {
+	if !btc.stale && (len(btc.keys) == 0 || key > btc.keys[len(btc.keys)-1]) {
+		btc.keys = append(btc.keys, key)
+	} else {
+		btc.stale = true
+	}
+}
+
+// sorted returns the keys in order, rebuilding the index if it is stale.
+func (btc *mapContainers) sorted() []uint64 {
+	if btc.stale {
+		statsHit("mapContainers/sort")
+		keys := make([]uint64, 0, len(btc.data))
+		for k := range btc.data {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		btc.keys, btc.stale = keys, false
+	}
+	return btc.keys
 }
 
 func (btc *mapContainers) GetOrCreate(key uint64) *Container {
@@ -44,6 +89,7 @@ func (btc *mapContainers) GetOrCreate(key uint64) *Container {
 	if !ok {
 		c = NewContainer()
 		btc.data[key] = c
+		btc.added(key)
 	}
 	return c
 }
@@ -60,6 +106,7 @@ func (btc *mapContainers) Clone() Containers {
 	for k, v := range btc.data {
 		nbtc.data[k] = v.Clone()
 	}
+	nbtc.keys = slices.Clone(btc.sorted())
 	return nbtc
 }
 
@@ -68,22 +115,17 @@ func (btc *mapContainers) Freeze() Containers {
 	for k, v := range btc.data {
 		nbtc.data[k] = v.Freeze()
 	}
+	nbtc.keys = slices.Clone(btc.sorted())
 	return nbtc
 }
 
 func (btc *mapContainers) Last() (key uint64, c *Container) {
-	for a, b := range btc.data {
-		key = a
-		c = b
-		break
-	}
-	for a, b := range btc.data {
-		if a > key {
-			key = a
-			c = b
-		}
+	keys := btc.sorted()
+	if len(keys) == 0 {
+		return 0, nil
 	}
-	return
+	key = keys[len(keys)-1]
+	return key, btc.data[key]
 }
 
 func (btc *mapContainers) Size() int {
@@ -92,6 +134,8 @@ func (btc *mapContainers) Size() int {
 
 func (btc *mapContainers) Reset() {
 	clear(btc.data)
+	// Iterators may still hold the old index.
+	btc.keys, btc.stale = nil, false
 }
 
 func (btc *mapContainers) ResetN(n int) {
@@ -100,20 +144,35 @@ func (btc *mapContainers) ResetN(n int) {
 }
 
 func (btc *mapContainers) Iterator(key uint64) (citer ContainerIterator, found bool) {
-
-	ls := make([]uint64, 0, len(btc.data))
-	for k := range btc.data {
-		ls = append(ls, k)
+	keys := btc.sorted()
+	i := search64(keys, key)
+	if i >= 0 {
+		found = true
+	} else {
+		i = -i - 1
 	}
-	slices.Sort(ls)
-	pos := slices.Index(ls, key)
-	if pos != -1 {
-		pos--
+	return &mapIterator{
+		keys: keys,
+		e:    btc,
+		i:    i,
+		step: 1,
+	}, found
+}
+
+func (btc *mapContainers) ReverseIterator(key uint64) (citer ContainerIterator, found bool) {
+	keys := btc.sorted()
+	i := search64(keys, key)
+	if i >= 0 {
+		found = true
+	} else {
+		// the insertion point is one past the last key before key.
+		i = -i - 2
 	}
 	return &mapIterator{
-		ls:  ls,
-		e:   btc,
-		key: pos,
+		keys: keys,
+		e:    btc,
+		i:    i,
+		step: -1,
 	}, found
 }
 
@@ -127,9 +186,12 @@ func (btc *mapContainers) Repair() {
 // (new-container, write). If write is true, the container is used to
 // replace the given container.
 func (btc *mapContainers) Update(key uint64, fn func(*Container, bool) (*Container, bool)) {
-	c, ok := btc.data[key]
-	c, ok = fn(c, ok)
-	if ok {
+	c, existed := btc.data[key]
+	c, write := fn(c, existed)
+	if write {
+		if !existed {
+			btc.added(key)
+		}
 		btc.data[key] = c
 	}
 }
@@ -146,19 +208,32 @@ func (btc *mapContainers) UpdateEvery(fn func(uint64, *Container, bool) (*Contai
 	}
 }
 
+// mapIterator walks a snapshot of the key index in either direction,
+// looking each key up as it goes, and skipping keys which have since been
+// removed, or which hold nil containers.
 type mapIterator struct {
-	ls  []uint64
-	e   *mapContainers
-	key int
+	keys  []uint64
+	e     *mapContainers
+	i     int // index in keys of the next key
+	step  int
+	key   uint64
+	value *Container
 }
 
 func (i *mapIterator) Close() {}
 
 func (i *mapIterator) Next() bool {
-	i.key++
-	return i.key < len(i.ls)
+	for i.i >= 0 && i.i < len(i.keys) {
+		i.key = i.keys[i.i]
+		i.value = i.e.data[i.key]
+		i.i += i.step
+		if i.value != nil {
+			return true
+		}
+	}
+	return false
 }
 
 func (i *mapIterator) Value() (uint64, *Container) {
-	return i.ls[i.key], i.e.data[i.ls[i.key]]
+	return i.key, i.value
 }
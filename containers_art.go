@@ -0,0 +1,613 @@
+// Copyright 2022 Molecula Corp. (DBA FeatureBase).
+// SPDX-License-Identifier: Apache-2.0
+package roaring
+
+import (
+	"math/bits"
+	"slices"
+)
+
+// artKind is the layout of an artNode.
+type artKind uint8
+
+const (
+	artLeaf    artKind = iota // holds one container
+	artNode4                  // up to 4 children, sorted by key byte
+	artNode16                 // up to 16 children, sorted by key byte
+	artNode48                 // up to 48 children, found through a 256-entry index
+	artNode256                // a child for each possible key byte
+)
+
+// artKeyLen is the number of bytes in a key.
+const artKeyLen = 8
+
+// artContainers is a Containers stored in an adaptive radix tree. Keys
+// are split into bytes, most significant first, and each interior node
+// branches on one byte, using the smallest of four layouts which holds its
+// children. Paths with no branches are compressed away: a node only exists
+// where keys diverge, and records the bytes above it which all its keys
+// share. So keys scattered sparsely across the key space cost little more
+// than the containers themselves, while dense ranges of keys fill the
+// larger nodes, and a lookup or seek visits at most one node per byte.
+type artContainers struct {
+	root *artNode
+	size int
+}
+
+// artNode is an interior node or a leaf. A node branches on the key byte
+// at depth, and prefix holds the bytes above depth shared by every key
+// under it, with the rest zeroed. A leaf is treated as a node at depth
+// artKeyLen, so its prefix is its whole key.
+//
+// For artNode4 and artNode16, keys holds the key bytes of the children in
+// order, parallel to children. For artNode48, keys is indexed by key byte
+// and holds one more than the index of the child in children, or zero.
+// For artNode256, children is indexed by key byte.
+type artNode struct {
+	kind     artKind
+	depth    uint8
+	n        uint16 // children in use
+	prefix   uint64
+	keys     []byte
+	children []*artNode
+	c        *Container // for leaves
+}
+
+func newARTContainers() *artContainers {
+	return &artContainers{}
+}
+
+// NewARTBitmap returns a Bitmap stored in an adaptive radix tree, which
+// suits container keys spread sparsely across the key space.
+func NewARTBitmap(a ...uint64) *Bitmap {
+	b := &Bitmap{
+		Containers: newARTContainers(),
+	}
+	// We have no way to report this.
+	// Because we just created Bitmap, its OpWriter is nil, so there
+	// is no code path which would cause Add() to return an error.
+	// Therefore, it's safe to swallow this error.
+	_, _ = b.Add(a...)
+	return b
+}
+
+// artByte returns the byte of key at depth.
+func artByte(key uint64, depth uint8) byte {
+	return byte(key >> (56 - 8*uint(depth)))
+}
+
+// artPrefix returns the bytes of key above depth.
+func artPrefix(key uint64, depth uint8) uint64 {
+	return key & (^uint64(0) << (64 - 8*uint(depth)))
+}
+
+func newARTLeaf(key uint64) *artNode {
+	return &artNode{kind: artLeaf, depth: artKeyLen, prefix: key}
+}
+
+// newARTNode returns an empty interior node of the given kind, branching
+// at depth, for keys sharing key's prefix.
+func newARTNode(kind artKind, depth uint8, key uint64) *artNode {
+	n := &artNode{kind: kind, depth: depth, prefix: artPrefix(key, depth)}
+	switch kind {
+	case artNode4:
+		n.keys, n.children = make([]byte, 0, 4), make([]*artNode, 0, 4)
+	case artNode16:
+		n.keys, n.children = make([]byte, 0, 16), make([]*artNode, 0, 16)
+	case artNode48:
+		n.keys, n.children = make([]byte, 256), make([]*artNode, 48)
+	case artNode256:
+		n.children = make([]*artNode, 256)
+	}
+	return n
+}
+
+// index returns the position in children of the child for key byte b.
+// For artNode4 and artNode16, if there is no such child, it returns the
+// position one would go in.
+func (n *artNode) index(b byte) (int, bool) {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i, k := range n.keys {
+			if k >= b {
+				return i, k == b
+			}
+		}
+		return len(n.keys), false
+	case artNode48:
+		i := n.keys[b]
+		return int(i) - 1, i != 0
+	case artNode256:
+		return int(b), n.children[b] != nil
+	}
+	return 0, false
+}
+
+func (n *artNode) full() bool {
+	switch n.kind {
+	case artNode4:
+		return n.n == 4
+	case artNode16:
+		return n.n == 16
+	case artNode48:
+		return n.n == 48
+	}
+	return false
+}
+
+// add adds child under key byte b, which must be absent, to a node which
+// isn't full.
+func (n *artNode) add(b byte, child *artNode) {
+	switch n.kind {
+	case artNode4, artNode16:
+		i, _ := n.index(b)
+		n.keys = slices.Insert(n.keys, i, b)
+		n.children = slices.Insert(n.children, i, child)
+	case artNode48:
+		i := slices.Index(n.children, nil)
+		n.children[i] = child
+		n.keys[b] = byte(i + 1)
+	case artNode256:
+		n.children[b] = child
+	}
+	n.n++
+}
+
+// remove removes the child under key byte b, which must be present.
+func (n *artNode) remove(b byte) {
+	switch n.kind {
+	case artNode4, artNode16:
+		i, _ := n.index(b)
+		n.keys = slices.Delete(n.keys, i, i+1)
+		n.children = slices.Delete(n.children, i, i+1)
+	case artNode48:
+		n.children[n.keys[b]-1] = nil
+		n.keys[b] = 0
+	case artNode256:
+		n.children[b] = nil
+	}
+	n.n--
+}
+
+// each calls fn for each child of n, in key byte order.
+func (n *artNode) each(fn func(b byte, child *artNode)) {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i, k := range n.keys {
+			fn(k, n.children[i])
+		}
+	case artNode48:
+		for b, i := range n.keys {
+			if i != 0 {
+				fn(byte(b), n.children[i-1])
+			}
+		}
+	case artNode256:
+		for b, child := range n.children {
+			if child != nil {
+				fn(byte(b), child)
+			}
+		}
+	}
+}
+
+// resize returns a node of the given kind with n's children.
+func (n *artNode) resize(kind artKind) *artNode {
+	out := newARTNode(kind, n.depth, n.prefix)
+	n.each(out.add)
+	return out
+}
+
+// grow returns a node of the next larger kind with n's children.
+func (n *artNode) grow() *artNode {
+	return n.resize(n.kind + 1)
+}
+
+// shrink returns n, or a smaller replacement for it if it has few enough
+// children. The bounds leave some slack, so a node whose size hovers
+// around a boundary isn't resized on every change. A node with a single
+// child is replaced by the child, which keeps paths compressed.
+func (n *artNode) shrink() *artNode {
+	switch {
+	case n.n == 1 && n.kind == artNode4:
+		return n.children[0]
+	case n.n <= 3 && n.kind == artNode16:
+		return n.resize(artNode4)
+	case n.n <= 12 && n.kind == artNode48:
+		return n.resize(artNode16)
+	case n.n <= 37 && n.kind == artNode256:
+		return n.resize(artNode48)
+	}
+	return n
+}
+
+// after returns the child with the lowest key byte at or above b, if any.
+func (n *artNode) after(b int) *artNode {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i, k := range n.keys {
+			if int(k) >= b {
+				return n.children[i]
+			}
+		}
+	case artNode48:
+		for ; b < 256; b++ {
+			if i := n.keys[b]; i != 0 {
+				return n.children[i-1]
+			}
+		}
+	case artNode256:
+		for ; b < 256; b++ {
+			if n.children[b] != nil {
+				return n.children[b]
+			}
+		}
+	}
+	return nil
+}
+
+// before returns the child with the highest key byte at or below b, if
+// any.
+func (n *artNode) before(b int) *artNode {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i := len(n.keys) - 1; i >= 0; i-- {
+			if int(n.keys[i]) <= b {
+				return n.children[i]
+			}
+		}
+	case artNode48:
+		for ; b >= 0; b-- {
+			if i := n.keys[b]; i != 0 {
+				return n.children[i-1]
+			}
+		}
+	case artNode256:
+		for ; b >= 0; b-- {
+			if n.children[b] != nil {
+				return n.children[b]
+			}
+		}
+	}
+	return nil
+}
+
+// first returns the leaf with the lowest key under n.
+func (n *artNode) first() *artNode {
+	for n.kind != artLeaf {
+		n = n.after(0)
+	}
+	return n
+}
+
+// last returns the leaf with the highest key under n.
+func (n *artNode) last() *artNode {
+	for n.kind != artLeaf {
+		n = n.before(255)
+	}
+	return n
+}
+
+// ceil returns the leaf with the lowest key at or above key under n.
+func (n *artNode) ceil(key uint64) *artNode {
+	if p := artPrefix(key, n.depth); p != n.prefix {
+		// Every key under n is on one side of key.
+		if n.prefix > p {
+			return n.first()
+		}
+		return nil
+	}
+	if n.kind == artLeaf {
+		return n
+	}
+	b := artByte(key, n.depth)
+	if i, ok := n.index(b); ok {
+		if l := n.children[i].ceil(key); l != nil {
+			return l
+		}
+	}
+	if child := n.after(int(b) + 1); child != nil {
+		return child.first()
+	}
+	return nil
+}
+
+// floor returns the leaf with the highest key at or below key under n.
+func (n *artNode) floor(key uint64) *artNode {
+	if p := artPrefix(key, n.depth); p != n.prefix {
+		if n.prefix < p {
+			return n.last()
+		}
+		return nil
+	}
+	if n.kind == artLeaf {
+		return n
+	}
+	b := artByte(key, n.depth)
+	if i, ok := n.index(b); ok {
+		if l := n.children[i].floor(key); l != nil {
+			return l
+		}
+	}
+	if child := n.before(int(b) - 1); child != nil {
+		return child.last()
+	}
+	return nil
+}
+
+// walk calls fn for every leaf under n, in key order.
+func (n *artNode) walk(fn func(leaf *artNode)) {
+	if n.kind == artLeaf {
+		fn(n)
+		return
+	}
+	n.each(func(_ byte, child *artNode) {
+		child.walk(fn)
+	})
+}
+
+// copy returns a copy of the tree under n, with each container replaced
+// by fn's result for it.
+func (n *artNode) copy(fn func(*Container) *Container) *artNode {
+	if n == nil {
+		return nil
+	}
+	out := *n
+	if n.kind == artLeaf {
+		out.c = fn(n.c)
+		return &out
+	}
+	out.keys = slices.Clone(n.keys)
+	out.children = slices.Clone(n.children)
+	for i, child := range out.children {
+		out.children[i] = child.copy(fn)
+	}
+	return &out
+}
+
+// leaf returns the leaf for key, if there is one.
+func (ac *artContainers) leaf(key uint64) *artNode {
+	n := ac.root
+	for n != nil && artPrefix(key, n.depth) == n.prefix {
+		if n.kind == artLeaf {
+			return n
+		}
+		i, ok := n.index(artByte(key, n.depth))
+		if !ok {
+			return nil
+		}
+		n = n.children[i]
+	}
+	return nil
+}
+
+// insert returns the leaf for key, adding an empty one if there isn't one.
+func (ac *artContainers) insert(key uint64) *artNode {
+	ref := &ac.root
+	for {
+		n := *ref
+		if n == nil {
+			*ref = newARTLeaf(key)
+			ac.size++
+			return *ref
+		}
+		if artPrefix(key, n.depth) != n.prefix {
+			// key leaves n's prefix at a byte above n; add a node
+			// there to hold both.
+			d := uint8(bits.LeadingZeros64(key^n.prefix) / 8)
+			l := newARTLeaf(key)
+			parent := newARTNode(artNode4, d, key)
+			parent.add(artByte(n.prefix, d), n)
+			parent.add(artByte(key, d), l)
+			*ref = parent
+			ac.size++
+			return l
+		}
+		if n.kind == artLeaf {
+			return n
+		}
+		b := artByte(key, n.depth)
+		if i, ok := n.index(b); ok {
+			ref = &n.children[i]
+			continue
+		}
+		if n.full() {
+			n = n.grow()
+			*ref = n
+		}
+		l := newARTLeaf(key)
+		n.add(b, l)
+		ac.size++
+		return l
+	}
+}
+
+// delete removes the leaf for key from the tree at ref, reporting whether
+// there was one.
+func (ac *artContainers) delete(ref **artNode, key uint64) bool {
+	n := *ref
+	if n == nil || artPrefix(key, n.depth) != n.prefix {
+		return false
+	}
+	if n.kind == artLeaf {
+		*ref = nil
+		ac.size--
+		return true
+	}
+	b := artByte(key, n.depth)
+	i, ok := n.index(b)
+	if !ok || !ac.delete(&n.children[i], key) {
+		return false
+	}
+	if n.children[i] == nil {
+		n.remove(b)
+		*ref = n.shrink()
+	}
+	return true
+}
+
+func (ac *artContainers) Get(key uint64) *Container {
+	if l := ac.leaf(key); l != nil {
+		return l.c
+	}
+	return nil
+}
+
+func (ac *artContainers) Put(key uint64, c *Container) {
+	// Like the btree, we don't store nil containers.
+	if c == nil {
+		ac.Remove(key)
+		return
+	}
+	ac.insert(key).c = c
+}
+
+func (ac *artContainers) Remove(key uint64) {
+	ac.delete(&ac.root, key)
+}
+
+func (ac *artContainers) GetOrCreate(key uint64) *Container {
+	l := ac.insert(key)
+	if l.c == nil {
+		l.c = NewContainer()
+	}
+	return l.c
+}
+
+func (ac *artContainers) Clone() Containers {
+	return &artContainers{
+		root: ac.root.copy((*Container).Clone),
+		size: ac.size,
+	}
+}
+
+func (ac *artContainers) Freeze() Containers {
+	return &artContainers{
+		root: ac.root.copy((*Container).Freeze),
+		size: ac.size,
+	}
+}
+
+func (ac *artContainers) Last() (key uint64, c *Container) {
+	if ac.root == nil {
+		return 0, nil
+	}
+	l := ac.root.last()
+	return l.prefix, l.c
+}
+
+func (ac *artContainers) Size() int {
+	return ac.size
+}
+
+func (ac *artContainers) Count() (n uint64) {
+	ac.walk(func(l *artNode) {
+		n += uint64(l.c.N())
+	})
+	return n
+}
+
+func (ac *artContainers) walk(fn func(leaf *artNode)) {
+	if ac.root != nil {
+		ac.root.walk(fn)
+	}
+}
+
+func (ac *artContainers) Reset() {
+	ac.root, ac.size = nil, 0
+}
+
+func (ac *artContainers) ResetN(n int) {
+	// we ignore n because it's impractical to preallocate the tree
+	ac.Reset()
+}
+
+func (ac *artContainers) Repair() {
+	ac.walk(func(l *artNode) {
+		l.c.Repair()
+	})
+}
+
+// Update calls fn (existing-container, existed), and expects
+// (new-container, write). If write is true, the container is used to
+// replace the given container.
+func (ac *artContainers) Update(key uint64, fn func(*Container, bool) (*Container, bool)) {
+	c := ac.Get(key)
+	nc, write := fn(c, c != nil)
+	if write {
+		ac.Put(key, nc)
+	}
+}
+
+// UpdateEvery calls fn (existing-container, existed), and expects
+// (new-container, write). If write is true, the container is used to
+// replace the given container.
+func (ac *artContainers) UpdateEvery(fn func(uint64, *Container, bool) (*Container, bool)) {
+	// Replacing a container leaves the tree's shape alone, but removing
+	// one doesn't, so removals wait until the walk is over.
+	var removed []uint64
+	ac.walk(func(l *artNode) {
+		nc, write := fn(l.prefix, l.c, true)
+		switch {
+		case !write:
+		case nc == nil:
+			removed = append(removed, l.prefix)
+		default:
+			l.c = nc
+		}
+	})
+	for _, key := range removed {
+		ac.Remove(key)
+	}
+}
+
+func (ac *artContainers) Iterator(key uint64) (citer ContainerIterator, found bool) {
+	return &artIterator{ac: ac, next: key}, ac.Get(key) != nil
+}
+
+func (ac *artContainers) ReverseIterator(key uint64) (citer ContainerIterator, found bool) {
+	return &artIterator{ac: ac, next: key, reverse: true}, ac.Get(key) != nil
+}
+
+// artIterator seeks to the next key from the root each time, which
+// visits at most one node per key byte, and means it doesn't hold on to
+// nodes which writes during the iteration may replace.
+type artIterator struct {
+	ac      *artContainers
+	next    uint64
+	done    bool
+	reverse bool
+	key     uint64
+	value   *Container
+}
+
+func (ai *artIterator) Close() {}
+
+func (ai *artIterator) Next() bool {
+	if ai.done || ai.ac.root == nil {
+		return false
+	}
+	var l *artNode
+	if ai.reverse {
+		l = ai.ac.root.floor(ai.next)
+	} else {
+		l = ai.ac.root.ceil(ai.next)
+	}
+	if l == nil {
+		ai.done = true
+		return false
+	}
+	ai.key, ai.value = l.prefix, l.c
+	if ai.reverse {
+		ai.done = ai.key == 0
+		ai.next = ai.key - 1
+	} else {
+		ai.done = ai.key == ^uint64(0)
+		ai.next = ai.key + 1
+	}
+	return true
+}
+
+func (ai *artIterator) Value() (uint64, *Container) {
+	return ai.key, ai.value
+}
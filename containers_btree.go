@@ -16,7 +16,8 @@ type bTreeContainers struct {
 
 func newBTreeContainers() *bTreeContainers {
 	return &bTreeContainers{
-		tree: treeNew(),
+		tree:    treeNew(),
+		lastKey: ^uint64(0),
 	}
 }
 
@@ -163,6 +164,19 @@ func (btc *bTreeContainers) Iterator(key uint64) (citer ContainerIterator, found
 	}, found
 }
 
+func (btc *bTreeContainers) ReverseIterator(key uint64) (citer ContainerIterator, found bool) {
+	// Prev steps back over the overshoot when Seek doesn't find key, so
+	// the first call yields the last container at or before key.
+	e, ok := btc.tree.Seek(key)
+	if ok {
+		found = true
+	}
+
+	return &btcReverseIterator{
+		e: e,
+	}, found
+}
+
 func (btc *bTreeContainers) Repair() {
 	e, _ := btc.tree.Seek(0)
 	_, c, err := e.Next()
@@ -220,3 +234,30 @@ func (i *btcIterator) Next() bool {
 func (i *btcIterator) Value() (uint64, *Container) {
 	return i.key, i.val
 }
+
+type btcReverseIterator struct {
+	e   *enumerator
+	key uint64
+	val *Container
+}
+
+func (i *btcReverseIterator) Close() {}
+
+func (i *btcReverseIterator) Next() bool {
+	k, v, err := i.e.Prev()
+	if err == io.EOF {
+		return false
+	}
+	if roaringParanoia {
+		if v == nil {
+			panic(fmt.Sprintf("got nil container for key %d", k))
+		}
+	}
+	i.key = k
+	i.val = v
+	return true
+}
+
+func (i *btcReverseIterator) Value() (uint64, *Container) {
+	return i.key, i.val
+}
@@ -0,0 +1,188 @@
+// Copyright 2022 Molecula Corp. (DBA FeatureBase).
+// SPDX-License-Identifier: Apache-2.0
+package roaring
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// concurrentContainers is a Containers which any number of goroutines can
+// read without locks while another goroutine writes to it. The key index
+// is copy-on-write: it is a sliceContainers which is never modified once
+// published, and every write builds a new one and swaps it in atomically.
+// Readers, including iterators, work from whichever index was current
+// when they started.
+//
+// Containers are frozen as they are stored, so a writer changing one gets
+// a copy, which it then Puts back, rather than modifying a container a
+// reader may be looking at. This makes writes much more expensive than
+// with the other implementations; it is meant for bitmaps which are read
+// far more often than they are written.
+//
+// Writes are serialized, but a read-modify-write sequence such as
+// Bitmap.Add is not atomic, so there should only be one writer at a time.
+type concurrentContainers struct {
+	mu    sync.Mutex // held by writers
+	index atomic.Pointer[sliceContainers]
+}
+
+func newConcurrentContainers() *concurrentContainers {
+	cc := &concurrentContainers{}
+	cc.index.Store(newSliceContainers())
+	return cc
+}
+
+// NewConcurrentBitmap returns a Bitmap which can be read from many
+// goroutines while one goroutine writes to it, without any locking by
+// the caller.
+func NewConcurrentBitmap(a ...uint64) *Bitmap {
+	b := &Bitmap{
+		Containers: newConcurrentContainers(),
+	}
+	// We have no way to report this.
+	// Because we just created Bitmap, its OpWriter is nil, so there
+	// is no code path which would cause Add() to return an error.
+	// Therefore, it's safe to swallow this error.
+	_, _ = b.Add(a...)
+	return b
+}
+
+// update calls fn with a private copy of the current index, then
+// publishes the copy. fn must not leave nil containers in it.
+func (cc *concurrentContainers) update(fn func(sc *sliceContainers)) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	old := cc.index.Load()
+	sc := &sliceContainers{
+		keys:       slices.Clone(old.keys),
+		containers: slices.Clone(old.containers),
+	}
+	fn(sc)
+	cc.index.Store(sc)
+}
+
+func (cc *concurrentContainers) Get(key uint64) *Container {
+	return cc.index.Load().Get(key)
+}
+
+func (cc *concurrentContainers) Put(key uint64, c *Container) {
+	// Like the btree, we don't store nil containers.
+	if c == nil {
+		cc.Remove(key)
+		return
+	}
+	cc.update(func(sc *sliceContainers) {
+		sc.Put(key, c.Freeze())
+	})
+}
+
+func (cc *concurrentContainers) Remove(key uint64) {
+	if cc.Get(key) == nil {
+		return
+	}
+	cc.update(func(sc *sliceContainers) {
+		sc.Remove(key)
+	})
+}
+
+func (cc *concurrentContainers) GetOrCreate(key uint64) *Container {
+	if c := cc.Get(key); c != nil {
+		return c
+	}
+	var c *Container
+	cc.update(func(sc *sliceContainers) {
+		// Another writer may have got here first.
+		if c = sc.Get(key); c == nil {
+			c = NewContainer().Freeze()
+			sc.Put(key, c)
+		}
+	})
+	return c
+}
+
+// Clone shares the containers with the new copy rather than cloning them.
+// They are frozen, so neither copy can change them.
+func (cc *concurrentContainers) Clone() Containers {
+	return cc.Freeze()
+}
+
+func (cc *concurrentContainers) Freeze() Containers {
+	other := &concurrentContainers{}
+	other.index.Store(cc.index.Load())
+	return other
+}
+
+func (cc *concurrentContainers) Last() (key uint64, c *Container) {
+	return cc.index.Load().Last()
+}
+
+func (cc *concurrentContainers) Size() int {
+	return cc.index.Load().Size()
+}
+
+func (cc *concurrentContainers) Count() uint64 {
+	return cc.index.Load().Count()
+}
+
+func (cc *concurrentContainers) Reset() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.index.Store(newSliceContainers())
+}
+
+func (cc *concurrentContainers) ResetN(n int) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	sc := newSliceContainers()
+	sc.ResetN(n)
+	cc.index.Store(sc)
+}
+
+func (cc *concurrentContainers) Iterator(key uint64) (citer ContainerIterator, found bool) {
+	return cc.index.Load().Iterator(key)
+}
+
+func (cc *concurrentContainers) ReverseIterator(key uint64) (citer ContainerIterator, found bool) {
+	return cc.index.Load().ReverseIterator(key)
+}
+
+// Repair has nothing to do: stored containers are frozen, and freezing a
+// container repairs it.
+func (cc *concurrentContainers) Repair() {}
+
+// Update calls fn (existing-container, existed), and expects
+// (new-container, write). If write is true, the container is used to
+// replace the given container.
+func (cc *concurrentContainers) Update(key uint64, fn func(*Container, bool) (*Container, bool)) {
+	cc.update(func(sc *sliceContainers) {
+		c := sc.Get(key)
+		nc, write := fn(c, c != nil)
+		switch {
+		case !write:
+		case nc == nil:
+			sc.Remove(key)
+		default:
+			sc.Put(key, nc.Freeze())
+		}
+	})
+}
+
+// UpdateEvery calls fn (existing-container, existed), and expects
+// (new-container, write). If write is true, the container is used to
+// replace the given container.
+func (cc *concurrentContainers) UpdateEvery(fn func(uint64, *Container, bool) (*Container, bool)) {
+	cc.update(func(sc *sliceContainers) {
+		removed := false
+		sc.UpdateEvery(func(key uint64, c *Container, existed bool) (*Container, bool) {
+			nc, write := fn(key, c, existed)
+			removed = removed || (write && nc == nil)
+			return nc.Freeze(), write
+		})
+		// Only now can we drop the containers fn removed.
+		if removed {
+			sc.Repair()
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 Molecula Corp. (DBA FeatureBase).
+// SPDX-License-Identifier: Apache-2.0
+package roaring_test
+
+import (
+	"testing"
+
+	"github.com/gernest/roaring"
+	"github.com/gernest/roaring/roaringtest"
+)
+
+// TestContainersConformance runs the roaringtest suite against each of the
+// package's own Containers implementations.
+func TestContainersConformance(t *testing.T) {
+	for _, backend := range []struct {
+		name      string
+		newBitmap func(...uint64) *roaring.Bitmap
+	}{
+		{"slice", roaring.NewSliceBitmap},
+		{"btree", roaring.NewBTreeBitmap},
+		{"map", roaring.NewMapBitmap},
+		{"concurrent", roaring.NewConcurrentBitmap},
+		{"persistent", roaring.NewPersistentBitmap},
+		{"art", roaring.NewARTBitmap},
+		{"forward-only", func(a ...uint64) *roaring.Bitmap {
+			return &roaring.Bitmap{Containers: forwardOnly{roaring.NewBTreeBitmap(a...).Containers}}
+		}},
+	} {
+		t.Run(backend.name, func(t *testing.T) {
+			roaringtest.TestContainers(t, func() roaring.Containers {
+				return backend.newBitmap().Containers
+			})
+		})
+	}
+}
+
+// forwardOnly hides the ReverseIterator of the Containers it wraps, as
+// with an implementation which doesn't provide one.
+type forwardOnly struct {
+	roaring.Containers
+}
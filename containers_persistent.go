@@ -0,0 +1,434 @@
+// Copyright 2022 Molecula Corp. (DBA FeatureBase).
+// SPDX-License-Identifier: Apache-2.0
+package roaring
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	persistentBits = 6                     // key bits consumed per trie level
+	persistentMask = 1<<persistentBits - 1 // mask for a slot within a node
+)
+
+// persistentContainers is a Containers stored in a persistent trie, so
+// that Freeze and Clone are O(1): the copy shares every node with the
+// original. Each node records the edit token of the Containers which
+// created it; a Containers only modifies nodes carrying its own token, and
+// copies any other node it needs to change, along with the path to it.
+// Freeze and Clone give both sides new tokens, so after a snapshot every
+// existing node is shared and the first write to each path copies it.
+//
+// Containers are frozen as they are stored, so a write through either side
+// gets its own copy of the container, following the usual frozen-container
+// rules, and reading a snapshot never writes to anything it shares. A
+// snapshot can be read, and further snapshots taken, from other goroutines
+// while one goroutine writes to the original.
+type persistentContainers struct {
+	mu     sync.Mutex // held by writers and Freeze
+	root   *persistentNode
+	height uint // levels below the root
+	size   int
+	edit   *persistentEdit
+}
+
+// persistentEdit identifies the nodes a persistentContainers may modify
+// in place. It is not empty so that every token has a distinct address.
+type persistentEdit struct {
+	_ byte
+}
+
+// persistentNode is a trie node with up to 64 slots, stored compactly:
+// mask holds the occupied slots, and children (for interior nodes) or
+// containers (for leaves) hold their entries in slot order.
+type persistentNode struct {
+	edit       *persistentEdit
+	mask       uint64
+	children   []*persistentNode
+	containers []*Container
+}
+
+func newPersistentContainers() *persistentContainers {
+	return &persistentContainers{edit: &persistentEdit{}}
+}
+
+// NewPersistentBitmap returns a Bitmap whose Freeze and Clone are O(1),
+// sharing structure with the original until either is written to.
+func NewPersistentBitmap(a ...uint64) *Bitmap {
+	b := &Bitmap{
+		Containers: newPersistentContainers(),
+	}
+	// We have no way to report this.
+	// Because we just created Bitmap, its OpWriter is nil, so there
+	// is no code path which would cause Add() to return an error.
+	// Therefore, it's safe to swallow this error.
+	_, _ = b.Add(a...)
+	return b
+}
+
+// slotOf returns the slot for key in a node at level.
+func slotOf(key uint64, level uint) uint64 {
+	return (key >> (level * persistentBits)) & persistentMask
+}
+
+// lowMask returns the key bits covered by a node at level.
+func lowMask(level uint) uint64 {
+	if (level+1)*persistentBits >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<((level+1)*persistentBits) - 1
+}
+
+// index returns the position of slot in n's compact entries, and whether
+// the slot is occupied.
+func (n *persistentNode) index(slot uint64) (int, bool) {
+	return bits.OnesCount64(n.mask & (1<<slot - 1)), n.mask&(1<<slot) != 0
+}
+
+// covers reports whether key fits under the current root.
+func (pc *persistentContainers) covers(key uint64) bool {
+	return key&^lowMask(pc.height) == 0
+}
+
+// own returns a version of n which pc may modify: n itself, a copy of it,
+// or a new node if n is nil.
+func (pc *persistentContainers) own(n *persistentNode, level uint) *persistentNode {
+	if n == nil {
+		return &persistentNode{edit: pc.edit}
+	}
+	if n.edit == pc.edit {
+		return n
+	}
+	cp := &persistentNode{edit: pc.edit, mask: n.mask}
+	if level == 0 {
+		cp.containers = append([]*Container(nil), n.containers...)
+	} else {
+		cp.children = append([]*persistentNode(nil), n.children...)
+	}
+	return cp
+}
+
+func (pc *persistentContainers) Get(key uint64) *Container {
+	if pc.root == nil || !pc.covers(key) {
+		return nil
+	}
+	n := pc.root
+	for level := pc.height; ; level-- {
+		i, ok := n.index(slotOf(key, level))
+		if !ok {
+			return nil
+		}
+		if level == 0 {
+			return n.containers[i]
+		}
+		n = n.children[i]
+	}
+}
+
+func (pc *persistentContainers) Put(key uint64, c *Container) {
+	// Like the btree, we don't store nil containers.
+	if c == nil {
+		pc.Remove(key)
+		return
+	}
+	c = c.Freeze()
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for pc.root != nil && !pc.covers(key) {
+		// Grow the trie upward; the old root becomes the first child.
+		pc.root = &persistentNode{edit: pc.edit, mask: 1, children: []*persistentNode{pc.root}}
+		pc.height++
+	}
+	if pc.root == nil {
+		for !pc.covers(key) {
+			pc.height++
+		}
+	}
+	pc.root = pc.put(pc.root, pc.height, key, c)
+}
+
+func (pc *persistentContainers) put(n *persistentNode, level uint, key uint64, c *Container) *persistentNode {
+	n = pc.own(n, level)
+	slot := slotOf(key, level)
+	i, ok := n.index(slot)
+	if level == 0 {
+		if ok {
+			n.containers[i] = c
+		} else {
+			n.mask |= 1 << slot
+			n.containers = append(n.containers, nil)
+			copy(n.containers[i+1:], n.containers[i:])
+			n.containers[i] = c
+			pc.size++
+		}
+		return n
+	}
+	if ok {
+		n.children[i] = pc.put(n.children[i], level-1, key, c)
+	} else {
+		n.mask |= 1 << slot
+		n.children = append(n.children, nil)
+		copy(n.children[i+1:], n.children[i:])
+		n.children[i] = pc.put(nil, level-1, key, c)
+	}
+	return n
+}
+
+func (pc *persistentContainers) Remove(key uint64) {
+	if pc.Get(key) == nil {
+		return
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.root = pc.remove(pc.root, pc.height, key)
+	pc.size--
+}
+
+// remove takes key, which must be present, out of n, returning the new
+// node, or nil if it is now empty.
+func (pc *persistentContainers) remove(n *persistentNode, level uint, key uint64) *persistentNode {
+	n = pc.own(n, level)
+	slot := slotOf(key, level)
+	i, _ := n.index(slot)
+	if level == 0 {
+		n.containers = append(n.containers[:i], n.containers[i+1:]...)
+		n.mask &^= 1 << slot
+	} else if child := pc.remove(n.children[i], level-1, key); child != nil {
+		n.children[i] = child
+		return n
+	} else {
+		n.children = append(n.children[:i], n.children[i+1:]...)
+		n.mask &^= 1 << slot
+	}
+	if n.mask == 0 {
+		return nil
+	}
+	return n
+}
+
+func (pc *persistentContainers) GetOrCreate(key uint64) *Container {
+	if c := pc.Get(key); c != nil {
+		return c
+	}
+	c := NewContainer().Freeze()
+	pc.Put(key, c)
+	return c
+}
+
+// Clone is as cheap as Freeze: the containers are shared, and they are
+// frozen, so neither side can change them.
+func (pc *persistentContainers) Clone() Containers {
+	return pc.Freeze()
+}
+
+func (pc *persistentContainers) Freeze() Containers {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	// Neither side may modify the nodes they now share.
+	pc.edit = &persistentEdit{}
+	return &persistentContainers{
+		root:   pc.root,
+		height: pc.height,
+		size:   pc.size,
+		edit:   &persistentEdit{},
+	}
+}
+
+func (pc *persistentContainers) Last() (key uint64, c *Container) {
+	k, c, ok := pc.prev(^uint64(0))
+	if !ok {
+		return 0, nil
+	}
+	return k, c
+}
+
+func (pc *persistentContainers) Size() int {
+	return pc.size
+}
+
+func (pc *persistentContainers) Count() (n uint64) {
+	pc.each(pc.root, pc.height, func(c *Container) {
+		n += uint64(c.N())
+	})
+	return n
+}
+
+// each calls fn for every container under n, in key order.
+func (pc *persistentContainers) each(n *persistentNode, level uint, fn func(c *Container)) {
+	if n == nil {
+		return
+	}
+	if level == 0 {
+		for _, c := range n.containers {
+			fn(c)
+		}
+		return
+	}
+	for _, child := range n.children {
+		pc.each(child, level-1, fn)
+	}
+}
+
+func (pc *persistentContainers) Reset() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.root, pc.height, pc.size = nil, 0, 0
+	pc.edit = &persistentEdit{}
+}
+
+func (pc *persistentContainers) ResetN(n int) {
+	// we ignore n because the trie can't usefully be preallocated
+	pc.Reset()
+}
+
+// Repair has nothing to do: stored containers are frozen, and freezing a
+// container repairs it.
+func (pc *persistentContainers) Repair() {}
+
+// Update calls fn (existing-container, existed), and expects
+// (new-container, write). If write is true, the container is used to
+// replace the given container.
+func (pc *persistentContainers) Update(key uint64, fn func(*Container, bool) (*Container, bool)) {
+	c := pc.Get(key)
+	nc, write := fn(c, c != nil)
+	if write {
+		pc.Put(key, nc)
+	}
+}
+
+// UpdateEvery calls fn (existing-container, existed), and expects
+// (new-container, write). If write is true, the container is used to
+// replace the given container.
+func (pc *persistentContainers) UpdateEvery(fn func(uint64, *Container, bool) (*Container, bool)) {
+	type write struct {
+		key uint64
+		c   *Container
+	}
+	var writes []write
+	citer, _ := pc.Iterator(0)
+	for citer.Next() {
+		key, c := citer.Value()
+		if nc, ok := fn(key, c, true); ok {
+			writes = append(writes, write{key, nc})
+		}
+	}
+	for _, w := range writes {
+		pc.Put(w.key, w.c)
+	}
+}
+
+// next returns the first container at or after key.
+func (pc *persistentContainers) next(key uint64) (uint64, *Container, bool) {
+	if pc.root == nil || !pc.covers(key) {
+		return 0, nil, false
+	}
+	return pc.nextIn(pc.root, pc.height, key)
+}
+
+func (pc *persistentContainers) nextIn(n *persistentNode, level uint, key uint64) (uint64, *Container, bool) {
+	slot := slotOf(key, level)
+	if i, ok := n.index(slot); ok {
+		if level == 0 {
+			return key, n.containers[i], true
+		}
+		if k, c, ok := pc.nextIn(n.children[i], level-1, key); ok {
+			return k, c, true
+		}
+	}
+	// Otherwise the answer is the smallest key in the next occupied slot.
+	higher := n.mask &^ (2<<slot - 1)
+	if higher == 0 {
+		return 0, nil, false
+	}
+	slot = uint64(bits.TrailingZeros64(higher))
+	key = key&^lowMask(level) | slot<<(level*persistentBits)
+	i, _ := n.index(slot)
+	for level > 0 {
+		n, level = n.children[i], level-1
+		slot = uint64(bits.TrailingZeros64(n.mask))
+		key |= slot << (level * persistentBits)
+		i = 0
+	}
+	return key, n.containers[i], true
+}
+
+// prev returns the last container at or before key.
+func (pc *persistentContainers) prev(key uint64) (uint64, *Container, bool) {
+	if pc.root == nil {
+		return 0, nil, false
+	}
+	if !pc.covers(key) {
+		key = lowMask(pc.height)
+	}
+	return pc.prevIn(pc.root, pc.height, key)
+}
+
+func (pc *persistentContainers) prevIn(n *persistentNode, level uint, key uint64) (uint64, *Container, bool) {
+	slot := slotOf(key, level)
+	if i, ok := n.index(slot); ok {
+		if level == 0 {
+			return key, n.containers[i], true
+		}
+		if k, c, ok := pc.prevIn(n.children[i], level-1, key); ok {
+			return k, c, true
+		}
+	}
+	// Otherwise the answer is the largest key in the previous occupied slot.
+	lower := n.mask & (1<<slot - 1)
+	if lower == 0 {
+		return 0, nil, false
+	}
+	slot = uint64(63 - bits.LeadingZeros64(lower))
+	key = key&^lowMask(level) | slot<<(level*persistentBits)
+	i, _ := n.index(slot)
+	for level > 0 {
+		n, level = n.children[i], level-1
+		slot = uint64(63 - bits.LeadingZeros64(n.mask))
+		key |= slot << (level * persistentBits)
+		i, _ = n.index(slot)
+	}
+	return key, n.containers[i], true
+}
+
+func (pc *persistentContainers) Iterator(key uint64) (citer ContainerIterator, found bool) {
+	return &persistentIterator{pc: pc, next: key}, pc.Get(key) != nil
+}
+
+func (pc *persistentContainers) ReverseIterator(key uint64) (citer ContainerIterator, found bool) {
+	return &persistentIterator{pc: pc, next: key, reverse: true}, pc.Get(key) != nil
+}
+
+// persistentIterator walks the trie by looking up the next key each time,
+// which costs a walk from the root, but doesn't hold on to any nodes.
+type persistentIterator struct {
+	pc      *persistentContainers
+	next    uint64
+	done    bool
+	reverse bool
+	key     uint64
+	value   *Container
+}
+
+func (pi *persistentIterator) Close() {}
+
+func (pi *persistentIterator) Next() bool {
+	if pi.done {
+		return false
+	}
+	var ok bool
+	if pi.reverse {
+		pi.key, pi.value, ok = pi.pc.prev(pi.next)
+		pi.done = !ok || pi.key == 0
+		pi.next = pi.key - 1
+	} else {
+		pi.key, pi.value, ok = pi.pc.next(pi.next)
+		pi.done = !ok || pi.key == ^uint64(0)
+		pi.next = pi.key + 1
+	}
+	return ok
+}
+
+func (pi *persistentIterator) Value() (uint64, *Container) {
+	return pi.key, pi.value
+}
@@ -157,6 +157,16 @@ func (sc *sliceContainers) Iterator(key uint64) (citer ContainerIterator, found
 	return &sliceIterator{e: sc, i: i, index: i}, found
 }
 
+func (sc *sliceContainers) ReverseIterator(key uint64) (citer ContainerIterator, found bool) {
+	i, found := sc.seek(key)
+	// seek returns the insertion point for a missing key, which is one
+	// past the last key before it.
+	if !found {
+		i--
+	}
+	return &sliceReverseIterator{e: sc, i: i}, found
+}
+
 // Repair tries to repair all containers,
 // results in nil and empty containers getting dropped from the slice.
 // For instance, that has to happen for writing the roaring format,
@@ -253,3 +263,33 @@ func (si *sliceIterator) Next() bool {
 func (si *sliceIterator) Value() (uint64, *Container) {
 	return si.key, si.value
 }
+
+type sliceReverseIterator struct {
+	e     *sliceContainers
+	i     int        // next e's index to get key, value
+	key   uint64     // current key
+	value *Container // current value
+}
+
+func (si *sliceReverseIterator) Close() {}
+
+func (si *sliceReverseIterator) Next() bool {
+	if si.e == nil {
+		return false
+	}
+
+	// discard nil containers from iteration, as sliceIterator does.
+	for si.i >= 0 && si.i < len(si.e.keys) {
+		si.key = si.e.keys[si.i]
+		si.value = si.e.containers[si.i]
+		si.i--
+		if si.value != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (si *sliceReverseIterator) Value() (uint64, *Container) {
+	return si.key, si.value
+}
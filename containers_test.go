@@ -5,7 +5,9 @@ package roaring
 import (
 	"bytes"
 	"math/rand"
+	"slices"
 	"sort"
+	"sync"
 	"testing"
 )
 
@@ -14,6 +16,18 @@ func TestContainersIterator(t *testing.T) {
 	testContainersIterator(slc, t)
 }
 
+func TestConcurrentContainersIterator(t *testing.T) {
+	testContainersIterator(newConcurrentContainers(), t)
+}
+
+func TestPersistentContainersIterator(t *testing.T) {
+	testContainersIterator(newPersistentContainers(), t)
+}
+
+func TestARTContainersIterator(t *testing.T) {
+	testContainersIterator(newARTContainers(), t)
+}
+
 func testContainersIterator(cs Containers, t *testing.T) {
 	itr, found := cs.Iterator(0)
 	if found {
@@ -91,6 +105,78 @@ func testContainersIterator(cs Containers, t *testing.T) {
 	}
 }
 
+func TestContainersReverseIterator(t *testing.T) {
+	for name, cs := range map[string]Containers{
+		"slice":      newSliceContainers(),
+		"btree":      newBTreeContainers(),
+		"map":        newMapContainers(),
+		"concurrent": newConcurrentContainers(),
+		"persistent": newPersistentContainers(),
+		"art":        newARTContainers(),
+		"fallback":   forwardOnlyContainers{newBTreeContainers()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			testContainersReverseIterator(cs, t)
+		})
+	}
+}
+
+// forwardOnlyContainers hides the ReverseIterator of the Containers it
+// wraps, so reverse iteration over it uses the fallback.
+type forwardOnlyContainers struct {
+	Containers
+}
+
+func testContainersReverseIterator(cs Containers, t *testing.T) {
+	itr, found := reverseIterator(cs, 0)
+	if found {
+		t.Fatalf("shouldn't have found 0 in empty containers")
+	}
+	if itr.Next() {
+		t.Fatal("Next() should be false for empty containers")
+	}
+
+	for _, key := range []uint64{1, 2, 3, 5, 6} {
+		cs.Put(key, NewContainerArray(make([]uint16, key)))
+	}
+
+	expect := func(itr ContainerIterator, keys ...uint64) {
+		t.Helper()
+		for _, exp := range keys {
+			if !itr.Next() {
+				t.Fatalf("%d should be next, but got false", exp)
+			}
+			if key, val := itr.Value(); key != exp || val.N() != int32(exp) {
+				t.Fatalf("Wrong k/v, exp: %d,%d got: %v,%v", exp, exp, key, val.N())
+			}
+		}
+		if itr.Next() {
+			t.Fatalf("itr should be done, but got true")
+		}
+	}
+
+	itr, found = reverseIterator(cs, 0)
+	if found {
+		t.Fatalf("shouldn't have found 0")
+	}
+	expect(itr)
+
+	itr, found = reverseIterator(cs, 3)
+	if !found {
+		t.Fatalf("should have found 3")
+	}
+	expect(itr, 3, 2, 1)
+
+	itr, found = reverseIterator(cs, 4)
+	if found {
+		t.Fatalf("shouldn't have found 4")
+	}
+	expect(itr, 3, 2, 1)
+
+	itr, _ = reverseIterator(cs, ^uint64(0))
+	expect(itr, 6, 5, 3, 2, 1)
+}
+
 func TestSliceContainers(t *testing.T) {
 	const size = 10
 	n := size
@@ -179,6 +265,309 @@ func TestSliceContainers(t *testing.T) {
 	})
 }
 
+// TestBTreeContainersKeyZero checks that the cached last lookup of a new
+// bTreeContainers doesn't stand in for key 0.
+func TestBTreeContainersKeyZero(t *testing.T) {
+	btc := newBTreeContainers()
+	if c := btc.Get(0); c != nil {
+		t.Fatalf("expected no container, got %v", c)
+	}
+	if c := btc.GetOrCreate(0); c == nil {
+		t.Fatal("expected a new container")
+	}
+	if btc.Size() != 1 {
+		t.Fatalf("expected 1 container, got %d", btc.Size())
+	}
+}
+
+// TestConcurrentBitmap checks that readers see consistent snapshots of a
+// bitmap while a writer changes it. Run it with -race.
+func TestConcurrentBitmap(t *testing.T) {
+	const rounds = 200
+	b := NewConcurrentBitmap()
+	done := make(chan struct{})
+	var wg, ready sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		ready.Add(1)
+		go func() {
+			defer wg.Done()
+			last := uint64(0)
+			for i := 0; ; i++ {
+				if i == 0 {
+					ready.Done()
+				}
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// The writer only ever adds whole ranges, so every
+				// snapshot holds a prefix of [0, n) for some n.
+				snap := b.Freeze()
+				n := snap.Count()
+				if n < last {
+					t.Errorf("count went backwards: %d after %d", n, last)
+					return
+				}
+				last = n
+				if n > 0 && (!snap.Contains(n-1) || snap.Contains(n)) {
+					t.Errorf("snapshot of %d values isn't a prefix", n)
+					return
+				}
+				if got := uint64(len(snap.Slice())); got != n {
+					t.Errorf("snapshot changed: counted %d, iterated %d", n, got)
+					return
+				}
+				_ = b.Contains(n)
+				_ = b.Max()
+			}
+		}()
+	}
+	// Make sure the readers overlap with the writes.
+	ready.Wait()
+	for i := uint64(0); i < rounds; i++ {
+		b.AddRange(i*1000, (i+1)*1000)
+		_, _ = b.Add((i+1)*1000 + 5)
+		_, _ = b.Remove((i+1)*1000 + 5)
+	}
+	close(done)
+	wg.Wait()
+	if n := b.Count(); n != rounds*1000 {
+		t.Fatalf("expected %d values, got %d", rounds*1000, n)
+	}
+}
+
+// TestConcurrentContainersNil checks that writing a nil container removes
+// the key rather than storing nil.
+func TestConcurrentContainersNil(t *testing.T) {
+	cc := newConcurrentContainers()
+	for k := uint64(0); k < 4; k++ {
+		cc.Put(k, NewContainerArray([]uint16{1}))
+	}
+	cc.Put(0, nil)
+	cc.Update(1, func(*Container, bool) (*Container, bool) { return nil, true })
+	cc.Update(9, func(*Container, bool) (*Container, bool) { return nil, true })
+	cc.UpdateEvery(func(k uint64, c *Container, _ bool) (*Container, bool) {
+		return nil, k == 3
+	})
+	if sc := cc.index.Load(); !slices.Equal(sc.keys, []uint64{2}) || len(sc.containers) != 1 {
+		t.Fatalf("expected only key 2, got %v", sc.keys)
+	}
+}
+
+// TestSharedBitmapOps checks that bitmap operations give the same results
+// on the copy-on-write backends as on the default one.
+func TestSharedBitmapOps(t *testing.T) {
+	for name, newBitmap := range map[string]func(...uint64) *Bitmap{
+		"concurrent": NewConcurrentBitmap,
+		"persistent": NewPersistentBitmap,
+	} {
+		t.Run(name, func(t *testing.T) {
+			testSharedBitmapOps(t, newBitmap())
+		})
+	}
+}
+
+func testSharedBitmapOps(t *testing.T, b *Bitmap) {
+	rnd := rand.New(rand.NewSource(21))
+	a := NewBitmap()
+	for i := 0; i < 2000; i++ {
+		v := uint64(rnd.Intn(1 << 20))
+		switch rnd.Intn(5) {
+		case 0:
+			a.Remove(v)
+			b.Remove(v)
+		case 1:
+			end := v + uint64(rnd.Intn(1<<17))
+			a.AddRange(v, end)
+			b.AddRange(v, end)
+		default:
+			a.Add(v)
+			b.Add(v)
+		}
+		if i%500 == 0 {
+			// Snapshots must not disturb the original.
+			_ = b.Freeze()
+		}
+	}
+	if !slices.Equal(a.Slice(), b.Slice()) {
+		t.Fatalf("expected %d values, got %d", a.Count(), b.Count())
+	}
+	other := NewBitmap(1, 2, 3, 1<<19, 1<<21)
+	for name, op := range map[string]func(x *Bitmap) *Bitmap{
+		"union":          func(x *Bitmap) *Bitmap { return x.Union(other) },
+		"intersect":      func(x *Bitmap) *Bitmap { return x.Intersect(other) },
+		"xor":            func(x *Bitmap) *Bitmap { return x.Xor(other) },
+		"difference":     func(x *Bitmap) *Bitmap { return x.Difference(other) },
+		"flip":           func(x *Bitmap) *Bitmap { return x.Flip(100, 1<<18) },
+		"shift":          func(x *Bitmap) *Bitmap { x, _ = x.Shift(70000); return x },
+		"union in place": func(x *Bitmap) *Bitmap { x = x.Clone(); x.UnionInPlace(other); return x },
+	} {
+		if got, want := op(b).Slice(), op(a).Slice(); !slices.Equal(got, want) {
+			t.Fatalf("%s: expected %d values, got %d", name, len(want), len(got))
+		}
+	}
+	if !slices.Equal(a.Slice(), b.Slice()) {
+		t.Fatalf("operations changed the bitmap: expected %d values, got %d", a.Count(), b.Count())
+	}
+}
+
+// TestARTContainers checks artContainers against sliceContainers while
+// filling a node through each of its sizes and emptying it again.
+func TestARTContainers(t *testing.T) {
+	ac, sc := newARTContainers(), newSliceContainers()
+	put := func(key uint64) {
+		c := NewContainerArray([]uint16{uint16(key)})
+		ac.Put(key, c)
+		sc.Put(key, c)
+	}
+	check := func() {
+		t.Helper()
+		if ac.Size() != sc.Size() {
+			t.Fatalf("expected %d containers, got %d", sc.Size(), ac.Size())
+		}
+		itr, _ := ac.Iterator(0)
+		defer itr.Close()
+		for _, key := range sc.keys {
+			if !itr.Next() {
+				t.Fatalf("iterator ended before key %d", key)
+			}
+			if k, c := itr.Value(); k != key || c != sc.Get(key) {
+				t.Fatalf("expected key %d, got %d", key, k)
+			}
+		}
+		if itr.Next() {
+			t.Fatal("iterator ran long")
+		}
+	}
+	// Keys sharing all but their lowest byte, under a sparse high key,
+	// so the root branches on the lowest byte of a compressed path.
+	const base = 0xab_cdef_0000_0000
+	rnd := rand.New(rand.NewSource(25))
+	order := rnd.Perm(256)
+	seen := map[artKind]bool{}
+	for _, i := range order {
+		put(base | uint64(i))
+		seen[ac.root.kind] = true
+	}
+	if ac.root.depth != 7 || ac.root.prefix != base {
+		t.Fatalf("expected the root to branch on byte 7 under %x, got byte %d under %x", uint64(base), ac.root.depth, ac.root.prefix)
+	}
+	check()
+	put(7)
+	put(base | 0x4100_0000)
+	check()
+	ac.Remove(7)
+	sc.Remove(7)
+	ac.Remove(base | 0x4100_0000)
+	sc.Remove(base | 0x4100_0000)
+	for _, kind := range []artKind{artNode4, artNode16, artNode48, artNode256} {
+		if !seen[kind] {
+			t.Fatalf("root never had kind %d", kind)
+		}
+	}
+
+	for _, i := range rnd.Perm(256) {
+		key := base | uint64(i)
+		ac.Remove(key)
+		sc.Remove(key)
+		if sc.Size()%17 == 0 {
+			check()
+		}
+		if sc.Size() == 1 && ac.root.kind != artLeaf {
+			t.Fatalf("expected a lone leaf, got kind %d", ac.root.kind)
+		}
+	}
+	if ac.root != nil || ac.Size() != 0 {
+		t.Fatal("expected an empty tree")
+	}
+}
+
+// TestPersistentBitmap checks that snapshots of a persistent bitmap are
+// independent of it.
+func TestPersistentBitmap(t *testing.T) {
+	b := NewPersistentBitmap()
+	b.AddRange(0, 300000)
+	snap := b.Freeze()
+	clone := b.Clone()
+
+	b.RemoveRange(1000, 2000)
+	b.DirectAdd(1 << 40)
+	_, _ = clone.Add(400000)
+	clone.DirectAddN(5, 1<<41)
+
+	if got := snap.Count(); got != 300000 {
+		t.Fatalf("snapshot: expected 300000 values, got %d", got)
+	}
+	if got := b.Count(); got != 300000-1000+1 || b.Contains(1500) || !b.Contains(1<<40) {
+		t.Fatalf("bitmap: got %d values", got)
+	}
+	if got := clone.Count(); got != 300002 || !clone.Contains(1500) || clone.Contains(1<<40) {
+		t.Fatalf("clone: got %d values", got)
+	}
+	if snap.Contains(400000) || snap.Contains(1<<41) {
+		t.Fatal("snapshot sees writes to the clone")
+	}
+}
+
+// TestPersistentBitmapSnapshots checks that snapshots of a persistent
+// bitmap can be taken and read while a writer changes it. Run it with
+// -race.
+func TestPersistentBitmapSnapshots(t *testing.T) {
+	const rounds = 200
+	b := NewPersistentBitmap()
+	b.AddRange(0, 1000)
+	first := b.Freeze()
+	done := make(chan struct{})
+	var wg, ready sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		ready.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				if i == 0 {
+					ready.Done()
+				}
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if !first.Contains(999) || first.Contains(1000) || first.Count() != 1000 {
+					t.Error("first snapshot changed")
+					return
+				}
+				// The writer only ever adds whole ranges, so every
+				// snapshot holds a prefix of [0, n) for some n.
+				snap := b.Freeze()
+				n := snap.Count()
+				if !snap.Contains(n-1) || snap.Contains(n) {
+					t.Errorf("snapshot of %d values isn't a prefix", n)
+					return
+				}
+				if got := uint64(len(snap.Slice())); got != n {
+					t.Errorf("snapshot changed: counted %d, iterated %d", n, got)
+					return
+				}
+			}
+		}()
+	}
+	// Make sure the readers overlap with the writes.
+	ready.Wait()
+	for i := uint64(1); i <= rounds; i++ {
+		for v := i * 1000; v < (i+1)*1000; v++ {
+			b.DirectAdd(v)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if n := b.Count(); n != (rounds+1)*1000 {
+		t.Fatalf("expected %d values, got %d", (rounds+1)*1000, n)
+	}
+}
+
 func genRun(r *rand.Rand) Interval16 {
 gen:
 	dat := r.Uint32()
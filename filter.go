@@ -1176,12 +1176,21 @@ func NewBitmapBSICountFilter(filter *Bitmap) *BitmapBSICountFilter {
 		negative:    containers[rowWidth*2 : rowWidth*3],
 		nextOffsets: make([]uint64, rowWidth),
 	}
+	fillRowFilter(filter, b.containers, b.nextOffsets)
+	return b
+}
+
+// fillRowFilter coerces filter to the offsets within a row, as
+// NewBitmapBSICountFilter describes, storing its containers by offset and
+// pointing each offset at the next one holding a filter container. A nil
+// filter matches everything.
+func fillRowFilter(filter *Bitmap, containers []*Container, nextOffsets []uint64) {
 	if filter == nil {
-		for i := range b.containers {
-			b.containers[i] = NewContainerRun([]Interval16{{Start: 0, Last: 65535}})
-			b.nextOffsets[i] = uint64(i+1) % rowWidth
+		for i := range containers {
+			containers[i] = NewContainerRun([]Interval16{{Start: 0, Last: 65535}})
+			nextOffsets[i] = uint64(i+1) % rowWidth
 		}
-		return b
+		return
 	}
 	count := 0
 	iter, _ := filter.Containers.Iterator(0)
@@ -1191,32 +1200,153 @@ func NewBitmapBSICountFilter(filter *Bitmap) *BitmapBSICountFilter {
 		// Coerce container key into the 0-rowWidth range we'll be
 		// using to compare against containers within each row.
 		k = k & keyMask
-		b.containers[k] = v
+		containers[k] = v
 		last = k
 		count++
 	}
 	// if there's only one container, we need to populate everything with
 	// its position.
 	if count == 1 {
-		for i := range b.containers {
-			b.nextOffsets[i] = last
+		for i := range containers {
+			nextOffsets[i] = last
 		}
 	} else {
 		// Point each container at the offset of the next valid container.
 		// With sparse bitmaps this will potentially make skipping faster.
-		for i := range b.containers {
-			if b.containers[i] != nil {
+		for i := range containers {
+			if containers[i] != nil {
 				for int(last) != i {
-					b.nextOffsets[last] = uint64(i)
+					nextOffsets[last] = uint64(i)
 					last = (last + 1) % rowWidth
 				}
 			}
 		}
 	}
+}
+
+// bitmapBSIRowCollector gathers the rows of a BSI field, limited to the
+// columns matching a filter, for operations which walk the value rows from
+// the most significant down. Fragments deliver rows least significant
+// first, so nothing can be decided until every row has been seen.
+type bitmapBSIRowCollector struct {
+	containers  []*Container
+	nextOffsets []uint64
+	rows        [][]*Container // by row, then offset within the row
+}
 
+func newBitmapBSIRowCollector(filter *Bitmap) bitmapBSIRowCollector {
+	b := bitmapBSIRowCollector{
+		containers:  make([]*Container, rowWidth),
+		nextOffsets: make([]uint64, rowWidth),
+		rows:        [][]*Container{make([]*Container, rowWidth)},
+	}
+	fillRowFilter(filter, b.containers, b.nextOffsets)
 	return b
 }
 
+func (b *bitmapBSIRowCollector) ConsiderKey(key FilterKey, n int32) FilterResult {
+	pos := key & keyMask
+	if b.containers[pos] == nil || n == 0 {
+		return key.RejectUntilOffset(b.nextOffsets[pos])
+	}
+	return key.NeedData()
+}
+
+func (b *bitmapBSIRowCollector) ConsiderData(key FilterKey, data *Container) FilterResult {
+	pos := key & keyMask
+	row := int(key >> rowExponent)
+	// The existence row is constrained by the filter, and every other row
+	// by the existence row.
+	filter := b.containers[pos]
+	if row > 0 {
+		filter = b.rows[0][pos]
+	}
+	c := intersect(filter, data)
+	if c == data {
+		c = c.Clone()
+	}
+	for len(b.rows) <= row {
+		b.rows = append(b.rows, make([]*Container, rowWidth))
+	}
+	b.rows[row][pos] = c
+	return key.MatchOneUntilOffset(b.nextOffsets[pos])
+}
+
+// bsi returns the collected rows as a BSI, with columns relative to the
+// start of the shard.
+func (b *bitmapBSIRowCollector) bsi() *BSI {
+	rows := make([]*Bitmap, len(b.rows))
+	for r, row := range b.rows {
+		rows[r] = NewBitmap()
+		for pos, c := range row {
+			if c.N() != 0 {
+				rows[r].Containers.Put(uint64(pos), c)
+			}
+		}
+	}
+	return NewBSIFromRows(rows)
+}
+
+// BitmapBSIMinFilter finds the smallest value of a BSI field among the
+// columns matching a filter, and the columns holding it. It expects the
+// same row layout and filter as BitmapBSICountFilter. Columns are reported
+// relative to the start of the shard.
+type BitmapBSIMinFilter struct {
+	bitmapBSIRowCollector
+}
+
+// NewBitmapBSIMinFilter creates a BitmapBSIMinFilter. The filter is
+// treated as it is by NewBitmapBSICountFilter.
+func NewBitmapBSIMinFilter(filter *Bitmap) *BitmapBSIMinFilter {
+	return &BitmapBSIMinFilter{newBitmapBSIRowCollector(filter)}
+}
+
+// Min returns the smallest value seen and the columns holding it. If no
+// columns matched, ok is false.
+func (b *BitmapBSIMinFilter) Min() (v int64, cols *Bitmap, ok bool) {
+	return b.bsi().Min(nil)
+}
+
+// BitmapBSIMaxFilter finds the largest value of a BSI field among the
+// columns matching a filter, and the columns holding it. It expects the
+// same row layout and filter as BitmapBSICountFilter. Columns are reported
+// relative to the start of the shard.
+type BitmapBSIMaxFilter struct {
+	bitmapBSIRowCollector
+}
+
+// NewBitmapBSIMaxFilter creates a BitmapBSIMaxFilter. The filter is
+// treated as it is by NewBitmapBSICountFilter.
+func NewBitmapBSIMaxFilter(filter *Bitmap) *BitmapBSIMaxFilter {
+	return &BitmapBSIMaxFilter{newBitmapBSIRowCollector(filter)}
+}
+
+// Max returns the largest value seen and the columns holding it. If no
+// columns matched, ok is false.
+func (b *BitmapBSIMaxFilter) Max() (v int64, cols *Bitmap, ok bool) {
+	return b.bsi().Max(nil)
+}
+
+// BitmapBSITopKFilter finds the k columns with the largest values of a BSI
+// field among the columns matching a filter. It expects the same row
+// layout and filter as BitmapBSICountFilter. Columns are reported relative
+// to the start of the shard.
+type BitmapBSITopKFilter struct {
+	bitmapBSIRowCollector
+	k uint64
+}
+
+// NewBitmapBSITopKFilter creates a BitmapBSITopKFilter. The filter is
+// treated as it is by NewBitmapBSICountFilter.
+func NewBitmapBSITopKFilter(filter *Bitmap, k uint64) *BitmapBSITopKFilter {
+	return &BitmapBSITopKFilter{newBitmapBSIRowCollector(filter), k}
+}
+
+// TopK returns the top k columns seen, as BSI.TopK does.
+func (b *BitmapBSITopKFilter) TopK() *Bitmap {
+	return b.bsi().TopK(b.k, nil)
+}
+
 // getNextFromIterator is a convenience function which calls Next and then Value
 // on a ContainerIterator and changes the key to a FilterKey, and
 // returns KEY_DONE if the iterator is done.
@@ -9,6 +9,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"reflect"
+
+	"github.com/gernest/roaring/internal/naive"
 )
 
 // FuzzBitmapUnmarshalBinary fuzz tests the unmarshaling of binary
@@ -48,11 +50,11 @@ func FuzzRoaringOps(data []byte) int {
 	if split > len(arr) {
 		split = len(arr)
 	}
-	// using removeSliceDuplicates guarantees that the slice inputs of the
+	// using naive.RemoveDuplicates guarantees that the slice inputs of the
 	// following functions do not have duplicates and are sorted, just as
 	// the Roaring Bitmap implementations are.
-	s1 := removeSliceDuplicates(arr[reserved:split])
-	s2 := removeSliceDuplicates(arr[split:])
+	s1 := naive.RemoveDuplicates(arr[reserved:split])
+	s2 := naive.RemoveDuplicates(arr[split:])
 	if len(s1) == 0 {
 		s1 = nil
 	}
@@ -75,31 +77,31 @@ func FuzzRoaringOps(data []byte) int {
 	}
 	// Pure functions
 
-	expected = []uint64{maxInSlice(s1), maxInSlice(s2)}
+	expected = []uint64{naive.Max(s1), naive.Max(s2)}
 	actual = []uint64{bm1.Max(), bm2.Max()}
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("max values:\n expected: %v\n got: %v", expected, actual))
 	}
 
-	expected = intersectSlice(s1, s2)
+	expected = naive.Intersect(s1, s2)
 	actual = bm1.Intersect(bm2).Slice()
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("intersection:\n expected: %v\n got: %v", expected, actual))
 	}
 
-	expected = unionSlice(s1, s2)
+	expected = naive.Union(s1, s2)
 	actual = bm1.Union(bm2).Slice()
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("union:\n expected: %v\n got: %v", expected, actual))
 	}
 
-	expected = differenceSlice(s1, s2)
+	expected = naive.Difference(s1, s2)
 	actual = bm1.Difference(bm2).Slice()
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("difference:\n expected: %v\n got: %v", expected, actual))
 	}
 
-	expected = xorSlice(s1, s2)
+	expected = naive.Xor(s1, s2)
 	actual = bm1.Xor(bm2).Slice()
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("XOR:\n expected: %v\n got: %v", expected, actual))
@@ -118,57 +120,57 @@ func FuzzRoaringOps(data []byte) int {
 		panic(fmt.Sprintf("count:\n expected: %v\n got: %v", expected, actual))
 	}
 
-	expect := countRangeSlice(s1, start, end)
+	expect := naive.CountRange(s1, start, end)
 	got := bm1.CountRange(start, end)
 	if expect != got {
 		panic(fmt.Sprintf("count range:\n count from %v to %v in slice %v and bitmap %v:\n expected %v got %v",
 			start, end, s1, bm1.Slice(), expect, got))
 	}
-	expect = countRangeSlice(s2, start, end)
+	expect = naive.CountRange(s2, start, end)
 	got = bm2.CountRange(start, end)
 	if expect != got {
 		panic(fmt.Sprintf("count range:\n count from %v to %v in slice %v and bitmap %v:\n expected %v got %v",
 			start, end, s2, bm2.Slice(), expect, got))
 	}
 
-	expected = rangeSlice(s1, start, end)
+	expected = naive.Range(s1, start, end)
 	actual = bm1.SliceRange(start, end)
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("slice range:\n from %v to %v in slice %v and bitmap %v:\n expected %v\n got %v",
 			start, end, s1, bm1.Slice(), expected, actual))
 	}
-	expected = rangeSlice(s2, start, end)
+	expected = naive.Range(s2, start, end)
 	actual = bm2.SliceRange(start, end)
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("slice range:\n from %v to %v in slice %v and bitmap %v:\n expected %v\n got %v",
 			start, end, s2, bm2.Slice(), expected, actual))
 	}
 
-	expect = uint64(len(intersectSlice(s1, s2)))
+	expect = uint64(len(naive.Intersect(s1, s2)))
 	got = bm1.IntersectionCount(bm2)
 	if expect != got {
 		panic(fmt.Sprintf("intersection count:\n expected %v got %v", expect, got))
 	}
 
-	_, found := containedInSlice(s1, rand)
+	_, found := naive.Contains(s1, rand)
 	if found != bm1.Contains(rand) {
 		panic(fmt.Sprintf("contains:\n %v contains %v: %v\n %v contains %v: %v", s1, rand, found,
 			bm1.Slice(), rand, bm1.Contains(rand)))
 	}
-	_, found = containedInSlice(s2, rand)
+	_, found = naive.Contains(s2, rand)
 	if found != bm2.Contains(rand) {
 		panic(fmt.Sprintf("contains:\n %v contains %v: %v\n %v contains %v: %v", s2, rand, found,
 			bm2.Slice(), rand, bm2.Contains(rand)))
 	}
 
 	if end-start < maxFlips {
-		expected = flipSlice(s1, start, end)
+		expected = naive.Flip(s1, start, end)
 		actual = bm1.Flip(start, end).Slice()
 		if !reflect.DeepEqual(expected, actual) {
 			panic(fmt.Sprintf("flip:\n from %v to %v in slice %v and bitmap %v\n expected %v\n got %v",
 				start, end, s1, bm1.Slice(), expected, actual))
 		}
-		expected = flipSlice(s2, start, end)
+		expected = naive.Flip(s2, start, end)
 		actual = bm2.Flip(start, end).Slice()
 		if !reflect.DeepEqual(expected, actual) {
 			panic(fmt.Sprintf("flip:\n from %v to %v in slice %v and bitmap %v\n expected %v\n got %v",
@@ -178,14 +180,14 @@ func FuzzRoaringOps(data []byte) int {
 
 	expected = make([]uint64, 0)
 	actual = make([]uint64, 0)
-	forEachInSlice(s1, func(v uint64) { expected = append(expected, v) })
+	naive.ForEach(s1, func(v uint64) { expected = append(expected, v) })
 	bm1.ForEach(func(v uint64) error { actual = append(actual, v); return nil })
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("for each:\n expected %v\n got %v", expected, actual))
 	}
 	expected = make([]uint64, 0)
 	actual = make([]uint64, 0)
-	forEachInSlice(s2, func(v uint64) { expected = append(expected, v) })
+	naive.ForEach(s2, func(v uint64) { expected = append(expected, v) })
 	bm2.ForEach(func(v uint64) error { actual = append(actual, v); return nil })
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("for each:\n expected %v\n got %v", expected, actual))
@@ -193,14 +195,14 @@ func FuzzRoaringOps(data []byte) int {
 
 	expected = make([]uint64, 0)
 	actual = make([]uint64, 0)
-	forEachInRangeSlice(s1, start, end, func(v uint64) { expected = append(expected, v) })
+	naive.ForEachInRange(s1, start, end, func(v uint64) { expected = append(expected, v) })
 	bm1.ForEachRange(start, end, func(v uint64) error { actual = append(actual, v); return nil })
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("for each in range:\n expected %v\n got %v", expected, actual))
 	}
 	expected = make([]uint64, 0)
 	actual = make([]uint64, 0)
-	forEachInRangeSlice(s2, start, end, func(v uint64) { expected = append(expected, v) })
+	naive.ForEachInRange(s2, start, end, func(v uint64) { expected = append(expected, v) })
 	bm2.ForEachRange(start, end, func(v uint64) error { actual = append(actual, v); return nil })
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("for each in range:\n expected %v\n got %v", expected, actual))
@@ -210,14 +212,14 @@ func FuzzRoaringOps(data []byte) int {
 	// The following tests operations that mutate bitmaps.
 
 	nbm1, nbm2 := bm1.Clone(), bm2.Clone()
-	expected = shiftSlice(s1, 1)
+	expected = naive.Shift(s1, 1)
 	tempBM, _ := nbm1.Shift(1)
 	actual = tempBM.Slice()
 	if !reflect.DeepEqual(expected, actual) {
 		panic(fmt.Sprintf("shift:\n in slice %v and bitmap %v \n expected %v\n got %v",
 			s1, bm1.Slice(), expected, actual))
 	}
-	expected = shiftSlice(s2, 1)
+	expected = naive.Shift(s2, 1)
 	tempBM, _ = nbm2.Shift(1)
 	actual = tempBM.Slice()
 	if !reflect.DeepEqual(expected, actual) {
@@ -230,7 +232,7 @@ func FuzzRoaringOps(data []byte) int {
 	rand3 := end
 
 	nbm1 = bm1.Clone()
-	expected, echanged := addNToSlice(s1, rand)
+	expected, echanged := naive.AddN(s1, rand)
 	achanged := nbm1.DirectAddN(rand)
 	actual = nbm1.Slice()
 	if echanged != achanged || !reflect.DeepEqual(expected, actual) {
@@ -238,7 +240,7 @@ func FuzzRoaringOps(data []byte) int {
 			rand, s1, bm1.Slice(), expected, echanged, actual, achanged))
 	}
 	nbm2 = bm2.Clone()
-	expected, echanged = addNToSlice(s2, rand2, rand3)
+	expected, echanged = naive.AddN(s2, rand2, rand3)
 	achanged = nbm2.DirectAddN(rand2, rand3)
 	actual = nbm2.Slice()
 	if echanged != achanged || !reflect.DeepEqual(expected, actual) {
@@ -247,7 +249,7 @@ func FuzzRoaringOps(data []byte) int {
 	}
 
 	nbm1 = bm1.Clone()
-	expected, echanged = removeNFromSlice(s1, rand2, rand3)
+	expected, echanged = naive.RemoveN(s1, rand2, rand3)
 	achanged = nbm1.DirectRemoveN(rand2, rand3)
 	actual = nbm1.Slice()
 	if echanged != achanged || !reflect.DeepEqual(expected, actual) {
@@ -255,7 +257,7 @@ func FuzzRoaringOps(data []byte) int {
 			rand2, rand3, s1, bm1.Slice(), expected, echanged, actual, achanged))
 	}
 	nbm2 = bm2.Clone()
-	expected, echanged = removeNFromSlice(s2, rand)
+	expected, echanged = naive.RemoveN(s2, rand)
 	achanged = nbm2.DirectRemoveN(rand)
 	actual = nbm2.Slice()
 	if echanged != achanged || !reflect.DeepEqual(expected, actual) {
@@ -264,7 +266,7 @@ func FuzzRoaringOps(data []byte) int {
 	}
 
 	nbm1, nbm2 = bm1.Clone(), bm2.Clone()
-	expected = unionSlice(s1, s2)
+	expected = naive.Union(s1, s2)
 	nbm1.UnionInPlace(nbm2)
 	actual = nbm1.Slice()
 	if !reflect.DeepEqual(expected, actual) {
@@ -1,24 +1,25 @@
 // Copyright 2022 Molecula Corp. (DBA FeatureBase).
 // SPDX-License-Identifier: Apache-2.0
-package roaring
+
+// Package naive reimplements Roaring Bitmap methods, but done naively on
+// uint64 slices. Most of these functions are inefficient, which is acceptable because
+// this is purely for testing consistency with Roaring internal operations. Thus, the
+// functions should be easily guaranteed to produce the correct results.
+package naive
 
 import (
 	"math"
 	"sort"
 )
 
-// The following functions reimplement Roaring Bitmap methods, but done naively on
-// uint64 slices. Most of these functions are inefficient, which is acceptable because
-// this is purely for testing consistency with Roaring internal operations. Thus, the
-// functions should be easily guaranteed to produce the correct results.
-
-func sortSlice(slice []uint64) {
+// Sort sorts slice in place.
+func Sort(slice []uint64) {
 	sort.Slice(slice, func(i, j int) bool { return slice[i] < slice[j] })
 }
 
-// removeSliceDuplicates removes duplicate values
+// RemoveDuplicates removes duplicate values
 // in the slice and sorts the output.
-func removeSliceDuplicates(slice []uint64) []uint64 {
+func RemoveDuplicates(slice []uint64) []uint64 {
 	// just throw slice into a map and
 	// get the values out again
 	hash := make(map[uint64]bool)
@@ -33,13 +34,13 @@ func removeSliceDuplicates(slice []uint64) []uint64 {
 	if len(unique) == 0 {
 		return nil
 	}
-	sortSlice(unique)
+	Sort(unique)
 	return unique
 }
 
-// intersect intersects two []uint64s, removing any duplicates
+// Intersect intersects two []uint64s, removing any duplicates
 // and sorting the final output.
-func intersectSlice(s1, s2 []uint64) []uint64 {
+func Intersect(s1, s2 []uint64) []uint64 {
 	// throw both slices in maps
 	hash1 := make(map[uint64]bool)
 	for _, val := range s1 {
@@ -62,12 +63,12 @@ func intersectSlice(s1, s2 []uint64) []uint64 {
 	if len(intersection) == 0 {
 		return nil
 	}
-	sortSlice(intersection)
+	Sort(intersection)
 	return intersection
 }
 
-// union unions two []uint64s and sorts the output.
-func unionSlice(s1, s2 []uint64) []uint64 {
+// Union unions two []uint64s and sorts the output.
+func Union(s1, s2 []uint64) []uint64 {
 	// just dump both slices in a map
 	// and get the values out again
 	hash := make(map[uint64]bool)
@@ -86,12 +87,12 @@ func unionSlice(s1, s2 []uint64) []uint64 {
 	if len(union) == 0 {
 		return nil
 	}
-	sortSlice(union)
+	Sort(union)
 	return union
 }
 
-// maxSlice returns the max in the slice.
-func maxInSlice(slice []uint64) uint64 {
+// Max returns the max in the slice.
+func Max(slice []uint64) uint64 {
 	if len(slice) == 0 {
 		return 0
 	}
@@ -105,9 +106,9 @@ func maxInSlice(slice []uint64) uint64 {
 	return max
 }
 
-// differenceSlice returns a slice containing the values
+// Difference returns a slice containing the values
 // present in the first slice but not in the second.
-func differenceSlice(s1, s2 []uint64) []uint64 {
+func Difference(s1, s2 []uint64) []uint64 {
 	// throw s2 in a map, check if each value
 	// in s1 is also in that map
 	hash := make(map[uint64]bool)
@@ -121,13 +122,13 @@ func differenceSlice(s1, s2 []uint64) []uint64 {
 		}
 	}
 	// make sure duplicates in s1 are not added
-	diff = removeSliceDuplicates(diff)
+	diff = RemoveDuplicates(diff)
 	return diff
 }
 
-// xorSlice returns an array containing the values
+// Xor returns an array containing the values
 // present in exactly one of the two slices.
-func xorSlice(s1, s2 []uint64) []uint64 {
+func Xor(s1, s2 []uint64) []uint64 {
 	// throw both slices in maps
 	hash1 := make(map[uint64]bool)
 	for _, val := range s1 {
@@ -155,13 +156,13 @@ func xorSlice(s1, s2 []uint64) []uint64 {
 	if len(xor) == 0 {
 		return nil
 	}
-	sortSlice(xor)
+	Sort(xor)
 	return xor
 }
 
-// shiftSlice adds n to each element and sorts the slice, but ignores any values that
+// Shift adds n to each element and sorts the slice, but ignores any values that
 // will cause an overflow. This does not modify the original slice, unlike the Roaring implementation.
-func shiftSlice(slice []uint64, n int) []uint64 {
+func Shift(slice []uint64, n int) []uint64 {
 	shifted := make([]uint64, 0)
 	for _, val := range slice {
 		if uint64(n) <= math.MaxUint64-val {
@@ -172,19 +173,19 @@ func shiftSlice(slice []uint64, n int) []uint64 {
 	if len(shifted) == 0 {
 		return nil
 	}
-	sortSlice(shifted)
+	Sort(shifted)
 	return shifted
 }
 
-// forEachSlice executes fn for each element in the slice.
-func forEachInSlice(slice []uint64, fn func(uint64)) {
+// ForEach executes fn for each element in the slice.
+func ForEach(slice []uint64, fn func(uint64)) {
 	for _, val := range slice {
 		fn(val)
 	}
 }
 
-// forEachRangeSlice executes fn for each element in slice that is in [start, end).
-func forEachInRangeSlice(slice []uint64, start, end uint64, fn func(uint64)) {
+// ForEachInRange executes fn for each element in slice that is in [start, end).
+func ForEachInRange(slice []uint64, start, end uint64, fn func(uint64)) {
 	for _, val := range slice {
 		if start <= val && val < end {
 			fn(val)
@@ -192,9 +193,9 @@ func forEachInRangeSlice(slice []uint64, start, end uint64, fn func(uint64)) {
 	}
 }
 
-// containedInSlice returns the index of the first instance of v and true
+// Contains returns the index of the first instance of v and true
 // if v is in slice and returns -1 and false otherwise.
-func containedInSlice(slice []uint64, v uint64) (int, bool) {
+func Contains(slice []uint64, v uint64) (int, bool) {
 	for idx := range slice {
 		if v == slice[idx] {
 			return idx, true
@@ -203,16 +204,16 @@ func containedInSlice(slice []uint64, v uint64) (int, bool) {
 	return -1, false
 }
 
-// addNToSlice adds the contents of a to slice and returns the new slice and
+// AddN adds the contents of a to slice and returns the new slice and
 // number of values successfully added. This somewhat mimics *Bitmap.DirectAddN
 // and but does not modify slice in place, so it returns that new slice instead.
-func addNToSlice(slice []uint64, a ...uint64) ([]uint64, int) {
+func AddN(slice []uint64, a ...uint64) ([]uint64, int) {
 	newSlice := make([]uint64, len(slice))
 	copy(newSlice, slice)
 	changed := 0
 
 	for _, val := range a {
-		if _, found := containedInSlice(newSlice, val); !found {
+		if _, found := Contains(newSlice, val); !found {
 			newSlice = append(newSlice, val)
 			changed++
 		}
@@ -221,20 +222,20 @@ func addNToSlice(slice []uint64, a ...uint64) ([]uint64, int) {
 	if len(newSlice) == 0 {
 		return nil, changed
 	}
-	sortSlice(newSlice)
+	Sort(newSlice)
 	return newSlice, changed
 }
 
-// removeNFromSlice removes the contents of a from slice and returns the new slice and
+// RemoveN removes the contents of a from slice and returns the new slice and
 // number of values successfully removed. This somewhat mimics *Bitmap.DirectRemoveN
 // and but does not modify slice in place, so it returns that new slice instead.
-func removeNFromSlice(slice []uint64, a ...uint64) ([]uint64, int) {
+func RemoveN(slice []uint64, a ...uint64) ([]uint64, int) {
 	newSlice := make([]uint64, len(slice))
 	copy(newSlice, slice)
 	changed := 0
 
 	for _, val := range a {
-		if i, found := containedInSlice(newSlice, val); found {
+		if i, found := Contains(newSlice, val); found {
 			newSlice = append(newSlice[:i], newSlice[i+1:]...)
 			changed++
 		}
@@ -243,12 +244,12 @@ func removeNFromSlice(slice []uint64, a ...uint64) ([]uint64, int) {
 	if len(newSlice) == 0 {
 		return nil, changed
 	}
-	sortSlice(newSlice)
+	Sort(newSlice)
 	return newSlice, changed
 }
 
-// countRangeSlice returns the number of values in slice that are in [start, end).
-func countRangeSlice(slice []uint64, start, end uint64) uint64 {
+// CountRange returns the number of values in slice that are in [start, end).
+func CountRange(slice []uint64, start, end uint64) uint64 {
 	count := uint64(0)
 	for _, val := range slice {
 		if start <= val && val < end {
@@ -258,8 +259,8 @@ func countRangeSlice(slice []uint64, start, end uint64) uint64 {
 	return count
 }
 
-// rangeSlice returns a sorted slice of integers between [start, end).
-func rangeSlice(slice []uint64, start, end uint64) []uint64 {
+// Range returns a sorted slice of integers between [start, end).
+func Range(slice []uint64, start, end uint64) []uint64 {
 	newSlice := make([]uint64, 0)
 	for _, val := range slice {
 		if start <= val && val < end {
@@ -270,16 +271,16 @@ func rangeSlice(slice []uint64, start, end uint64) []uint64 {
 	if len(newSlice) == 0 {
 		return nil
 	}
-	sortSlice(newSlice)
+	Sort(newSlice)
 	return newSlice
 }
 
-// flipSplice returns a slice containing all numbers in [start, end]
+// Flip returns a slice containing all numbers in [start, end]
 // that are not in the original slice, as well as the numbers in the
 // original slice not in [start, end].
-func flipSlice(slice []uint64, start, end uint64) []uint64 {
+func Flip(slice []uint64, start, end uint64) []uint64 {
 	if start > end {
-		sortSlice(slice)
+		Sort(slice)
 		return slice
 	}
 
@@ -296,7 +297,7 @@ func flipSlice(slice []uint64, start, end uint64) []uint64 {
 	}
 
 	for i := start; i <= end; i++ {
-		if _, found := containedInSlice(slice, i); !found {
+		if _, found := Contains(slice, i); !found {
 			flipped = append(flipped, i)
 		}
 	}
@@ -304,6 +305,6 @@ func flipSlice(slice []uint64, start, end uint64) []uint64 {
 	if len(flipped) == 0 {
 		return nil
 	}
-	sortSlice(flipped)
+	Sort(flipped)
 	return flipped
 }
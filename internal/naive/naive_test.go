@@ -1,6 +1,6 @@
 // Copyright 2022 Molecula Corp. (DBA FeatureBase).
 // SPDX-License-Identifier: Apache-2.0
-package roaring
+package naive
 
 import (
 	"math/rand"
@@ -17,7 +17,7 @@ func TestSortSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		sortSlice(test.a)
+		Sort(test.a)
 		if !reflect.DeepEqual(test.a, test.expected) {
 			t.Fatalf("unexpected sorting: %v", test.a)
 		}
@@ -37,7 +37,7 @@ func TestRemoveSliceDuplicates(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got := removeSliceDuplicates(test.a)
+		got := RemoveDuplicates(test.a)
 		if !reflect.DeepEqual(got, test.expected) {
 			t.Fatalf("expected %v, got %v", test.expected, got)
 		}
@@ -64,7 +64,7 @@ func TestIntersectSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got := intersectSlice(test.a, test.b)
+		got := Intersect(test.a, test.b)
 		if !reflect.DeepEqual(test.expected, got) {
 			t.Fatalf("expected %v, got %v", test.expected, got)
 		}
@@ -91,7 +91,7 @@ func TestUnionSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got := unionSlice(test.a, test.b)
+		got := Union(test.a, test.b)
 		if !reflect.DeepEqual(test.expected, got) {
 			t.Fatalf("expected %v, got %v", test.expected, got)
 		}
@@ -102,14 +102,14 @@ func TestMaxInSlice(t *testing.T) {
 	// arbitrary, we just want to get the same values every time
 	r := rand.New(rand.NewSource(23))
 	a := []uint64{1, 4, 9, 5, 24, 13}
-	v := maxInSlice(a)
+	v := Max(a)
 	if uint64(24) != v {
 		t.Fatalf("expected %v, but got %v", uint64(24), v)
 	}
 
 	for i := uint64(1000); i <= uint64(100000); i += uint64(r.Intn(35)) + 1 {
 		a = append(a, i)
-		if v = maxInSlice(a); v != i {
+		if v = Max(a); v != i {
 			t.Fatalf("expected %v, but got %v", i, v)
 		}
 	}
@@ -135,7 +135,7 @@ func TestDifferenceSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got := differenceSlice(test.a, test.b)
+		got := Difference(test.a, test.b)
 		if !reflect.DeepEqual(test.expected, got) {
 			t.Fatalf("expected %v, got %v", test.expected, got)
 		}
@@ -167,7 +167,7 @@ func TestXorSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got := xorSlice(test.a, test.b)
+		got := Xor(test.a, test.b)
 		if !reflect.DeepEqual(test.expected, got) {
 			t.Fatalf("expected %v, got %v", test.expected, got)
 		}
@@ -198,7 +198,7 @@ func TestShiftSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got := shiftSlice(test.a, test.shift)
+		got := Shift(test.a, test.shift)
 
 		if !reflect.DeepEqual(got, test.expected) {
 			t.Fatalf("expected %v, got %v", test.expected, got)
@@ -210,7 +210,7 @@ func TestForEachInSlice(t *testing.T) {
 	a := []uint64{1, 4, 9, 5, 24, 13}
 	c := make([]uint64, 0)
 
-	forEachInSlice(a, func(v uint64) {
+	ForEach(a, func(v uint64) {
 		c = append(c, v+1)
 	})
 	if !reflect.DeepEqual(c, []uint64{2, 5, 10, 6, 25, 14}) {
@@ -222,7 +222,7 @@ func TestForEachInRangeSlice(t *testing.T) {
 	a := []uint64{1, 4, 9, 5, 24, 13}
 	c := make([]uint64, 0)
 
-	forEachInRangeSlice(a, uint64(3), uint64(12), func(v uint64) {
+	ForEachInRange(a, uint64(3), uint64(12), func(v uint64) {
 		c = append(c, v+1)
 	})
 	if !reflect.DeepEqual(c, []uint64{5, 10, 6}) {
@@ -252,7 +252,7 @@ func TestContainedInSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		idx, found := containedInSlice(test.a, test.c)
+		idx, found := Contains(test.a, test.c)
 		if found != test.found {
 			t.Fatalf("expected value of found: %v, got %v", test.found, found)
 		}
@@ -290,7 +290,7 @@ func TestAddNToSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got, changed := addNToSlice(test.a, test.b...)
+		got, changed := AddN(test.a, test.b...)
 		if !reflect.DeepEqual(test.expected, got) {
 			t.Fatalf("expected slices %v, got %v", test.expected, got)
 		}
@@ -328,7 +328,7 @@ func TestRemoveNFromSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got, changed := removeNFromSlice(test.a, test.b...)
+		got, changed := RemoveN(test.a, test.b...)
 		if !reflect.DeepEqual(test.expected, got) {
 			t.Fatalf("expected slices %v, got %v", test.expected, got)
 		}
@@ -372,7 +372,7 @@ func TestCountRangeSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got := countRangeSlice(test.a, test.start, test.end)
+		got := CountRange(test.a, test.start, test.end)
 		if got != test.expected {
 			t.Fatalf("expected %v, got %v", test.expected, got)
 		}
@@ -407,7 +407,7 @@ func TestRangeSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got := rangeSlice(test.a, test.start, test.end)
+		got := Range(test.a, test.start, test.end)
 		if !reflect.DeepEqual(got, test.expected) {
 			t.Fatalf("expected %v, got %v", test.expected, got)
 		}
@@ -442,7 +442,7 @@ func TestFlipSlice(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		got := flipSlice(test.a, test.start, test.end)
+		got := Flip(test.a, test.start, test.end)
 		if !reflect.DeepEqual(got, test.expected) {
 			t.Fatalf("expected %v, got %v", test.expected, got)
 		}
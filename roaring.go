@@ -11,6 +11,7 @@ import (
 	"io"
 	"iter"
 	"math/bits"
+	"slices"
 	"sort"
 	"unsafe"
 
@@ -107,6 +108,41 @@ func newFileShouldBeTruncatedError(err error, offset int64) *fileShouldBeTruncat
 	return &fileShouldBeTruncatedError{advisoryError: advisoryError{e: err}, offset: offset}
 }
 
+// ReverseContainers is implemented by Containers which can iterate over
+// their containers in descending key order. It is optional: for Containers
+// which don't implement it, reverse iteration collects the containers with
+// Iterator instead, which costs time and memory proportional to the
+// number of containers before the starting key.
+type ReverseContainers interface {
+	Containers
+
+	// ReverseIterator returns a ContainerIterator which after a call to Next(), a call to
+	// Value() will return the last container at or before key, and then the containers
+	// before it in descending key order. found will be true if a container is found at key.
+	ReverseIterator(key uint64) (citer ContainerIterator, found bool)
+}
+
+// reverseIterator returns a reverse iterator over cs starting at key, as
+// described by ReverseContainers.ReverseIterator, whether or not cs
+// implements it.
+func reverseIterator(cs Containers, key uint64) (citer ContainerIterator, found bool) {
+	if rc, ok := cs.(ReverseContainers); ok {
+		return rc.ReverseIterator(key)
+	}
+	sc := &sliceContainers{}
+	citer, _ = cs.Iterator(0)
+	for citer.Next() {
+		k, c := citer.Value()
+		if k > key {
+			break
+		}
+		sc.keys = append(sc.keys, k)
+		sc.containers = append(sc.containers, c)
+	}
+	citer.Close()
+	return sc.ReverseIterator(key)
+}
+
 type Containers interface {
 	// Get returns nil if the key does not exist.
 	Get(key uint64) *Container
@@ -547,6 +583,13 @@ func (b *Bitmap) MinAt(start uint64) (uint64, bool) {
 	return v, !eof
 }
 
+// MaxAt returns the highest value in the bitmap at most equal to its argument.
+// Second return value is true if such a value exists.
+func (b *Bitmap) MaxAt(v uint64) (uint64, bool) {
+	v, eof := b.ReverseIteratorAt(v).Next()
+	return v, !eof
+}
+
 // Max returns the highest value in the bitmap.
 // Returns zero if the bitmap is empty.
 func (b *Bitmap) Max() uint64 {
@@ -555,6 +598,11 @@ func (b *Bitmap) Max() uint64 {
 	}
 
 	hb, c := b.Containers.Last()
+	if c.N() == 0 {
+		// Removals can leave empty containers behind, so look further back.
+		v, _ := b.MaxAt(^uint64(0))
+		return v
+	}
 	lb := c.max()
 	return hb<<16 | uint64(lb)
 }
@@ -641,32 +689,112 @@ func (b *Bitmap) CountRange(start, end uint64) (n uint64) {
 	return n
 }
 
-// Slice returns a slice of all integers in the bitmap.
-func (b *Bitmap) Slice() []uint64 {
-	a := make([]uint64, 0, b.Count())
-	itr := b.Iterator()
-	itr.Seek(0)
+// Rank returns the number of bits set in the bitmap which are less than
+// or equal to v.
+func (b *Bitmap) Rank(v uint64) (n uint64) {
+	hb := highbits(v)
+	citer, _ := b.Containers.Iterator(0)
+	for citer.Next() {
+		k, c := citer.Value()
+		if k > hb {
+			break
+		}
+		if k < hb {
+			n += uint64(c.N())
+			continue
+		}
+		n += uint64(c.Rank(lowbits(v)))
+	}
+	return n
+}
 
-	for v, eof := itr.Next(); !eof; v, eof = itr.Next() {
-		a = append(a, v)
+// Select returns the i-th (zero-based) smallest value set in the bitmap.
+// The second return value is false if the bitmap has i or fewer bits set.
+// Whole containers are skipped using their cardinality, so only the
+// container holding the value is ever examined.
+func (b *Bitmap) Select(i uint64) (uint64, bool) {
+	citer, _ := b.Containers.Iterator(0)
+	for citer.Next() {
+		k, c := citer.Value()
+		n := uint64(c.N())
+		if i >= n {
+			i -= n
+			continue
+		}
+		v, ok := c.Select(int32(i))
+		if !ok {
+			// c.N() disagreed with the contents; this can't happen
+			// unless the container is corrupt.
+			return 0, false
+		}
+		return k<<16 | uint64(v), true
 	}
-	return a
+	return 0, false
+}
+
+// Slice returns a slice of all integers in the bitmap.
+func (b *Bitmap) Slice() []uint64 {
+	// Not nil, even when the bitmap is empty.
+	n := int(b.Count())
+	return b.appendTo(make([]uint64, 0, n), n)
 }
 
 // SliceRange returns a slice of integers between [start, end).
 func (b *Bitmap) SliceRange(start, end uint64) []uint64 {
+	return b.AppendRangeTo(nil, start, end)
+}
+
+// AppendTo appends the integers in the bitmap to dst, growing it at most
+// once, and returns the extended slice.
+func (b *Bitmap) AppendTo(dst []uint64) []uint64 {
+	return b.appendTo(dst, int(b.Count()))
+}
+
+// appendTo appends the n integers in the bitmap to dst.
+func (b *Bitmap) appendTo(dst []uint64, n int) []uint64 {
+	want := len(dst) + n
+	dst = slices.Grow(dst, n)
+	itr := b.Iterator()
+	// Stop once we have them all, rather than asking for more with a full
+	// slice, so a dst with exactly enough room is used as it is.
+	for len(dst) < want {
+		n := itr.NextMany(dst[len(dst):want])
+		if n == 0 {
+			break
+		}
+		dst = dst[:len(dst)+n]
+	}
+	return dst
+}
+
+// AppendRangeTo appends the integers in the bitmap between [start, end) to
+// dst, growing it at most once, and returns the extended slice.
+func (b *Bitmap) AppendRangeTo(dst []uint64, start, end uint64) []uint64 {
 	if roaringSentinel {
 		if start > end {
 			panic(fmt.Sprintf("getting slice in range but %v > %v", start, end))
 		}
 	}
-	var a []uint64
+	if start >= end {
+		return dst
+	}
+	want := len(dst) + int(b.CountRange(start, end))
+	dst = slices.Grow(dst, want-len(dst))
 	itr := b.Iterator()
 	itr.Seek(start)
-	for v, eof := itr.Next(); !eof && v < end; v, eof = itr.Next() {
-		a = append(a, v)
+	for len(dst) < want {
+		batch := dst[len(dst):want]
+		n := itr.NextMany(batch)
+		// Values are in order, so only the last batch can cross end.
+		if i, _ := slices.BinarySearch(batch[:n], end); i < n {
+			return dst[:len(dst)+i]
+		}
+		if n == 0 {
+			break
+		}
+		dst = dst[:len(dst)+n]
 	}
-	return a
+	return dst
 }
 
 // ForEach executes fn for each value in the bitmap.
@@ -694,6 +822,136 @@ func (b *Bitmap) RangeAll() iter.Seq[uint64] {
 	}
 }
 
+// RangeAllReverse returns a sequence of every value in the bitmap, in
+// descending order.
+func (b *Bitmap) RangeAllReverse() iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		itr := b.ReverseIterator()
+		for v, eof := itr.Next(); !eof; v, eof = itr.Next() {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Runs returns a sequence of the maximal runs of consecutive values in the
+// bitmap, as inclusive [start, last] pairs in ascending order. Runs which
+// cross container boundaries are merged.
+func (b *Bitmap) Runs() iter.Seq[[2]uint64] {
+	return b.runsFrom(0, ^uint64(0))
+}
+
+// Gaps returns a sequence of the maximal runs of values in [start, end)
+// which are not in the bitmap, as inclusive [start, last] pairs in
+// ascending order.
+func (b *Bitmap) Gaps(start, end uint64) iter.Seq[[2]uint64] {
+	return func(yield func([2]uint64) bool) {
+		if start >= end {
+			return
+		}
+		// next is the lowest value not yet accounted for.
+		next := start
+		for r := range b.runsFrom(start, end-1) {
+			if r[1] < next {
+				continue
+			}
+			if r[0] >= end {
+				break
+			}
+			if r[0] > next && !yield([2]uint64{next, r[0] - 1}) {
+				return
+			}
+			if r[1] >= end-1 {
+				return
+			}
+			next = r[1] + 1
+		}
+		yield([2]uint64{next, end - 1})
+	}
+}
+
+// NextAbsent returns the lowest value at least equal to start which is not
+// in the bitmap. The second return value is false if every value from
+// start onwards is set.
+func (b *Bitmap) NextAbsent(start uint64) (uint64, bool) {
+	key, lb := highbits(start), lowbits(start)
+	citer, _ := b.Containers.Iterator(key)
+	for citer.Next() {
+		k, c := citer.Value()
+		if k < key {
+			continue
+		}
+		// There's no container for key, so nothing in it is set.
+		if k > key {
+			break
+		}
+		if v, ok := c.nextAbsent(lb); ok {
+			return k<<16 | uint64(v), true
+		}
+		if key == maxContainerKey {
+			return 0, false
+		}
+		key, lb = key+1, 0
+	}
+	return key<<16 | uint64(lb), true
+}
+
+// ComplementRange returns a sequence of the values in [start, end) which
+// are not in the bitmap, in ascending order.
+func (b *Bitmap) ComplementRange(start, end uint64) iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		for gap := range b.Gaps(start, end) {
+			for v := gap[0]; ; v++ {
+				if !yield(v) {
+					return
+				}
+				if v == gap[1] {
+					break
+				}
+			}
+		}
+	}
+}
+
+// runsFrom is Runs, starting from the container holding start. The first
+// run may therefore begin before start. A run reaching last is yielded as
+// soon as it does, without merging the rest of it, and ends the sequence.
+func (b *Bitmap) runsFrom(start, last uint64) iter.Seq[[2]uint64] {
+	return func(yield func([2]uint64) bool) {
+		var cur [2]uint64
+		have := false
+		citer, _ := b.Containers.Iterator(highbits(start))
+		for citer.Next() {
+			k, c := citer.Value()
+			base := k << 16
+			ok := c.forEachRun(func(r Interval16) bool {
+				first, rlast := base|uint64(r.Start), base|uint64(r.Last)
+				if have && cur[1]+1 == first {
+					cur[1] = rlast
+				} else {
+					if have && !yield(cur) {
+						return false
+					}
+					cur, have = [2]uint64{first, rlast}, true
+				}
+				if cur[1] >= last {
+					have = false
+					yield(cur)
+					return false
+				}
+				return true
+			})
+			if !ok {
+				return
+			}
+		}
+		if have {
+			yield(cur)
+		}
+	}
+}
+
 // ForEachRange executes fn for each value in the bitmap between [start, end).
 func (b *Bitmap) ForEachRange(start, end uint64, fn func(uint64) error) error {
 	itr := b.Iterator()
@@ -766,6 +1024,150 @@ func (b *Bitmap) IntersectionCount(other *Bitmap) uint64 {
 	return n
 }
 
+// Intersects returns true if b and other have any set bits in common. It
+// stops at the first shared bit, so is cheaper than IntersectionCount.
+func (b *Bitmap) Intersects(other *Bitmap) bool {
+	iiter, _ := b.Containers.Iterator(0)
+	jiter, _ := other.Containers.Iterator(0)
+	i, j := iiter.Next(), jiter.Next()
+	ki, ci := iiter.Value()
+	kj, cj := jiter.Value()
+	for i && j {
+		if ki < kj {
+			i = iiter.Next()
+			ki, ci = iiter.Value()
+		} else if ki > kj {
+			j = jiter.Next()
+			kj, cj = jiter.Value()
+		} else {
+			if intersectionAny(ci, cj) {
+				return true
+			}
+			i, j = iiter.Next(), jiter.Next()
+			ki, ci = iiter.Value()
+			kj, cj = jiter.Value()
+		}
+	}
+	return false
+}
+
+// UnionCount returns the number of set bits that would result in a union
+// between b and other, without materializing the union.
+func (b *Bitmap) UnionCount(other *Bitmap) uint64 {
+	return b.Count() + other.Count() - b.IntersectionCount(other)
+}
+
+// DifferenceCount returns the number of set bits that would result in the
+// difference of b and other, without materializing the difference.
+func (b *Bitmap) DifferenceCount(other *Bitmap) uint64 {
+	return b.Count() - b.IntersectionCount(other)
+}
+
+// XorCount returns the number of set bits that would result in the
+// exclusive or of b and other, without materializing the result.
+func (b *Bitmap) XorCount(other *Bitmap) uint64 {
+	return b.Count() + other.Count() - 2*b.IntersectionCount(other)
+}
+
+// Jaccard returns the Jaccard similarity of b and other: the size of their
+// intersection divided by the size of their union. Two empty bitmaps have
+// a similarity of 0.
+func (b *Bitmap) Jaccard(other *Bitmap) float64 {
+	intersection := b.IntersectionCount(other)
+	union := b.Count() + other.Count() - intersection
+	if union == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(union)
+}
+
+// IsSubsetOf returns true if every bit set in b is also set in other.
+func (b *Bitmap) IsSubsetOf(other *Bitmap) bool {
+	iiter, _ := b.Containers.Iterator(0)
+	jiter, _ := other.Containers.Iterator(0)
+	j, kj, cj := nextNonEmpty(jiter)
+	for iiter.Next() {
+		ki, ci := iiter.Value()
+		if ci.N() == 0 {
+			continue
+		}
+		for j && kj < ki {
+			j, kj, cj = nextNonEmpty(jiter)
+		}
+		if !j || kj > ki || !ci.isSubsetOf(cj) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSupersetOf returns true if every bit set in other is also set in b.
+func (b *Bitmap) IsSupersetOf(other *Bitmap) bool {
+	return other.IsSubsetOf(b)
+}
+
+// Compare orders b and other by comparing their values in ascending order,
+// the same way slices.Compare would compare the results of Slice. It
+// returns -1 if b sorts first, 1 if other does, and 0 if they are equal.
+func (b *Bitmap) Compare(other *Bitmap) int {
+	iiter, _ := b.Containers.Iterator(0)
+	jiter, _ := other.Containers.Iterator(0)
+	i, ki, ci := nextNonEmpty(iiter)
+	j, kj, cj := nextNonEmpty(jiter)
+	for i && j {
+		// The first value which differs determines the order, and
+		// the bitmap with the lower key has the lower value.
+		if ki < kj {
+			return -1
+		} else if ki > kj {
+			return 1
+		}
+		if ci != cj && (ci.N() != cj.N() || ci.BitwiseCompare(cj) != nil) {
+			// x is the first value which is in one container but not
+			// the other. The bitmap holding it sorts first, unless the
+			// other bitmap has nothing after x and is therefore a
+			// prefix of it.
+			x, _ := xor(ci, cj).Select(0)
+			if ci.Contains(x) {
+				if cj.max() > x {
+					return -1
+				}
+				if more, _, _ := nextNonEmpty(jiter); more {
+					return -1
+				}
+				return 1
+			}
+			if ci.max() > x {
+				return 1
+			}
+			if more, _, _ := nextNonEmpty(iiter); more {
+				return 1
+			}
+			return -1
+		}
+		i, ki, ci = nextNonEmpty(iiter)
+		j, kj, cj = nextNonEmpty(jiter)
+	}
+	if i {
+		return 1
+	} else if j {
+		return -1
+	}
+	return 0
+}
+
+// nextNonEmpty advances iter past any empty containers, returning the
+// next non-empty container and its key, if there is one.
+func nextNonEmpty(iter ContainerIterator) (bool, uint64, *Container) {
+	for iter.Next() {
+		k, c := iter.Value()
+		if c.N() > 0 {
+			return true, k, c
+		}
+	}
+	return false, 0, nil
+}
+
 // Intersect returns the intersection of b and other.
 func (b *Bitmap) Intersect(other *Bitmap) *Bitmap {
 	output := NewBitmap()
@@ -1656,42 +2058,46 @@ func (b *Bitmap) Xor(other *Bitmap) *Bitmap {
 	return output
 }
 
-// Shift shifts the contents of b by 1.
-//
-// NOTE: This method is unsupported. See the `Shift()`
-// method on `Row` in `row.go`.
+// Shift shifts the contents of b by n, which may be negative. Whole
+// multiples of 65536 move containers to a new key; any remainder is
+// spliced across neighbouring containers. Bits which would be shifted
+// below 0 or beyond the largest possible value are dropped.
 func (b *Bitmap) Shift(n int) (*Bitmap, error) {
-	if n != 1 {
-		return nil, errors.New("cannot shift by a value other than 1")
+	var keyShift int64
+	var r uint16
+	if n >= 0 {
+		keyShift, r = int64(uint64(n)>>16), uint16(n)
+	} else {
+		m := uint64(-n)
+		keyShift, r = -int64(m>>16), uint16(m)
+		// Shifting down by r is the same as shifting down by a whole
+		// container, then back up by 65536-r.
+		if r != 0 {
+			keyShift--
+			r = -r
+		}
 	}
+
 	output := NewBitmap()
-	iiter, _ := b.Containers.Iterator(0)
-	lastCarry := false
-	lastKey := uint64(0)
-	for iiter.Next() {
-		ki, ci := iiter.Value()
-		if lastCarry && ki > lastKey+1 {
-			extra := NewContainerArray([]uint16{0})
-			output.Containers.Put(lastKey+1, extra)
-			lastCarry = false
-		}
-		o, carry := shift(ci)
-		if lastCarry {
-			o, _ = o.add(0)
+	put := func(key int64, c *Container) {
+		if c == nil || key < 0 || key > maxContainerKey {
+			return
 		}
-		if o.N() > 0 {
-			output.Containers.Put(ki, o)
+		// The low bits of one container and the bits carried out of
+		// the one before it can land on the same key.
+		if existing := output.Containers.Get(uint64(key)); existing != nil {
+			c = union(existing, c).Optimize()
 		}
-		lastCarry = carry
-		lastKey = ki
+		output.Containers.Put(uint64(key), c)
 	}
-	// As long as the carry wasn't from the max container,
-	// append a new container and add the carried bit.
-	if lastCarry && lastKey != maxContainerKey {
-		extra := NewContainerArray([]uint16{0})
-		output.Containers.Put(lastKey+1, extra)
+	iiter, _ := b.Containers.Iterator(0)
+	for iiter.Next() {
+		ki, ci := iiter.Value()
+		lo, hi := shiftContainer(ci, r)
+		key := int64(ki) + keyShift
+		put(key, lo)
+		put(key+1, hi)
 	}
-
 	return output, nil
 }
 
@@ -2589,6 +2995,22 @@ func (b *Bitmap) IteratorAt(start uint64) *Iterator {
 	return itr
 }
 
+// ReverseIterator returns a new iterator for the bitmap which returns values
+// in descending order.
+func (b *Bitmap) ReverseIterator() *ReverseIterator {
+	itr := &ReverseIterator{bitmap: b}
+	itr.Seek(^uint64(0))
+	return itr
+}
+
+// ReverseIteratorAt returns a new descending iterator for the bitmap,
+// starting at the last value equal to or less than start.
+func (b *Bitmap) ReverseIteratorAt(start uint64) *ReverseIterator {
+	itr := &ReverseIterator{bitmap: b}
+	itr.Seek(start)
+	return itr
+}
+
 // Ops returns the number of write ops the bitmap is aware of in its ops
 // log, and their total bit count.
 func (b *Bitmap) Ops() (ops int, opN int) {
@@ -2800,39 +3222,121 @@ func (b *Bitmap) Check() error {
 	return a
 }
 
-// Flip performs a logical negate of the bits in the range [start,end].
+// Flip performs a logical negate of the bits in the range [start,end],
+// returning the result as a new bitmap. Unlike FlipInPlace, end is
+// inclusive, so Flip(start, end) matches FlipInPlace(start, end+1) on a
+// copy of b.
 func (b *Bitmap) Flip(start, end uint64) *Bitmap {
 	if roaringSentinel {
 		if start > end {
 			panic(fmt.Sprintf("flipping in range but %v > %v", start, end))
 		}
 	}
-	result := NewBitmap()
-	itr := b.Iterator()
-	v, eof := itr.Next()
-	// copy over previous bits.
-	for v < start && !eof {
-		result.DirectAdd(v)
-		v, eof = itr.Next()
-	}
-	// flip bits in range .
-	for i := start; i <= end; i++ {
-		if eof {
-			result.DirectAdd(i)
-		} else if v == i {
-			v, eof = itr.Next()
-		} else {
-			result.DirectAdd(i)
-		}
+	// The result shares b's containers until a flip actually touches
+	// them, just like Union does.
+	result := b.Freeze()
+	if start > end {
+		return result
 	}
-	// add remaining.
-	for !eof {
-		result.DirectAdd(v)
-		v, eof = itr.Next()
+	if end == ^uint64(0) {
+		// end+1 would wrap, so flip the last bit on its own.
+		result.FlipInPlace(start, end)
+		result.updateRange(end, end, (*Container).flipRange)
+		return result
 	}
+	result.FlipInPlace(start, end+1)
 	return result
 }
 
+// FlipInPlace performs a logical negate of the bits in the range
+// [start,end), modifying b in place. Unlike Flip, end is exclusive, as
+// with AddRange and RemoveRange. Like the other range operations it works
+// a container at a time and bypasses the op log.
+func (b *Bitmap) FlipInPlace(start, end uint64) {
+	if start >= end {
+		return
+	}
+	b.updateRange(start, end-1, (*Container).flipRange)
+}
+
+// AddRange sets every bit in the range [start,end), bypassing the op log.
+// Containers entirely within the range become full run containers.
+func (b *Bitmap) AddRange(start, end uint64) {
+	if start >= end {
+		return
+	}
+	b.updateRange(start, end-1, (*Container).addRange)
+}
+
+// RemoveRange clears every bit in the range [start,end), bypassing the
+// op log. Containers entirely within the range are dropped.
+func (b *Bitmap) RemoveRange(start, end uint64) {
+	if start >= end {
+		return
+	}
+	skey, ekey := highbits(start), highbits(end-1)
+
+	// Only existing containers can be affected, so rather than visiting
+	// every key in the range, collect the ones which are present. We can't
+	// modify the containers while iterating over them.
+	var keys []uint64
+	citer, _ := b.Containers.Iterator(skey)
+	for citer.Next() {
+		k, _ := citer.Value()
+		if k < skey {
+			continue
+		}
+		if k > ekey {
+			break
+		}
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		lo, hi := uint16(0), uint16(MaxContainerVal)
+		if k == skey {
+			lo = lowbits(start)
+		}
+		if k == ekey {
+			hi = lowbits(end - 1)
+		}
+		c := b.Containers.Get(k)
+		if newC := c.removeRange(lo, hi); newC != c {
+			if newC == nil {
+				b.Containers.Remove(k)
+			} else {
+				b.Containers.Put(k, newC)
+			}
+		}
+	}
+}
+
+// updateRange applies op to every container key covering the inclusive
+// range [start,last], passing each container the inclusive bounds of the
+// range which fall within it. Containers which op empties are removed.
+func (b *Bitmap) updateRange(start, last uint64, op func(c *Container, lo, hi uint16) *Container) {
+	skey, ekey := highbits(start), highbits(last)
+	for k := skey; ; k++ {
+		lo, hi := uint16(0), uint16(MaxContainerVal)
+		if k == skey {
+			lo = lowbits(start)
+		}
+		if k == ekey {
+			hi = lowbits(last)
+		}
+		c := b.Containers.Get(k)
+		if newC := op(c, lo, hi); newC != c {
+			if newC == nil {
+				b.Containers.Remove(k)
+			} else {
+				b.Containers.Put(k, newC)
+			}
+		}
+		if k == ekey {
+			break
+		}
+	}
+}
+
 // BitmapInfo represents a point-in-time snapshot of bitmap stats.
 type BitmapInfo struct {
 	OpN            int
@@ -3052,8 +3556,88 @@ func (itr *Iterator) Next() (v uint64, eof bool) {
 	}
 }
 
-// peek returns the current value.
-func (itr *Iterator) peek() uint64 {
+// NextMany fills buf with the next values in the bitmap, decoding each
+// container directly rather than a value at a time. It returns the number
+// of values written, which is only less than len(buf) once the iterator
+// reaches the end of the bitmap. NextMany and Next may be used together.
+func (itr *Iterator) NextMany(buf []uint64) (n int) {
+	for n < len(buf) && itr.c != nil {
+		high := itr.key << 16
+		if itr.c.isArray() {
+			a := itr.c.array()
+			for _, v := range a[itr.j+1 : min(len(a), int(itr.j)+1+len(buf)-n)] {
+				buf[n] = high | uint64(v)
+				n++
+				itr.j++
+			}
+			if int(itr.j) < len(a)-1 {
+				return n
+			}
+		} else if itr.c.isRun() {
+			// As in Next, j may be -1 at the start of a run container.
+			if itr.j == -1 {
+				itr.j = 0
+			}
+			runs := itr.c.runs()
+			for int(itr.j) < len(runs) && n < len(buf) {
+				r := runs[itr.j]
+				runLength := int32(r.Last - r.Start)
+				if itr.k >= runLength {
+					// Leave j on the last run, as Next does, so that
+					// a following call to Next sees a valid run.
+					if int(itr.j) == len(runs)-1 {
+						break
+					}
+					itr.j, itr.k = itr.j+1, -1
+					continue
+				}
+				cnt := min(int(runLength-itr.k), len(buf)-n)
+				base := high | uint64(int32(r.Start)+itr.k+1)
+				for i := 0; i < cnt; i++ {
+					buf[n+i] = base + uint64(i)
+				}
+				n += cnt
+				itr.k += int32(cnt)
+			}
+			if len(runs) > 0 && (int(itr.j) < len(runs)-1 || itr.k < int32(runs[len(runs)-1].Last-runs[len(runs)-1].Start)) {
+				return n
+			}
+		} else {
+			bitmap := itr.c.bitmap()
+			for itr.j < MaxContainerVal && n < len(buf) {
+				next := itr.j + 1
+				w := next >> 6
+				word := bitmap[w] >> uint(next%64) << uint(next%64)
+				for word != 0 && n < len(buf) {
+					itr.j = w<<6 + int32(trailingZeroN(word))
+					buf[n] = high | uint64(itr.j)
+					n++
+					word &= word - 1
+				}
+				if word != 0 {
+					return n
+				}
+				// Everything up to the end of this word has been read.
+				itr.j = w<<6 + 63
+			}
+			if itr.j < MaxContainerVal {
+				return n
+			}
+		}
+
+		// Reached the end of the container, move to the next one.
+		if !itr.citer.Next() {
+			itr.c = nil
+			return n
+		}
+		itr.key, itr.c = itr.citer.Value()
+		itr.j, itr.k = -1, -1
+	}
+	return n
+}
+
+// peek returns the current value.
+func (itr *Iterator) peek() uint64 {
 	if itr.c == nil {
 		return 0
 	}
@@ -3066,6 +3650,114 @@ func (itr *Iterator) peek() uint64 {
 	return itr.key<<16 | uint64(itr.j)
 }
 
+// ReverseIterator represents an iterator over a Bitmap which returns
+// values in descending order.
+type ReverseIterator struct {
+	bitmap *Bitmap
+	citer  ContainerIterator
+	key    uint64
+	c      *Container
+	j      int32 // array index, run index, or bit index of the next value; -1 when the container is exhausted
+	v      int32 // next value within the current run
+}
+
+// Seek moves to the last value equal to or less than `seek`.
+func (itr *ReverseIterator) Seek(seek uint64) {
+	itr.citer, _ = reverseIterator(itr.bitmap.Containers, highbits(seek))
+	if !itr.citer.Next() {
+		itr.c = nil
+		return // eof
+	}
+	itr.key, itr.c = itr.citer.Value()
+
+	// Seek is larger than max(itr.c), so start from the end of it.
+	if itr.key < highbits(seek) {
+		itr.position(MaxContainerVal)
+		return
+	}
+	itr.position(int32(lowbits(seek)))
+}
+
+// position moves to the last value in the current container which is
+// equal to or less than lim, setting j to -1 if there isn't one.
+func (itr *ReverseIterator) position(lim int32) {
+	if itr.c.isArray() {
+		itr.j = search32(itr.c.array(), uint16(lim))
+		if itr.j < 0 {
+			// Step back from the insertion point.
+			itr.j = -itr.j - 2
+		}
+		return
+	}
+	if itr.c.isRun() {
+		runs := itr.c.runs()
+		itr.j = int32(sort.Search(len(runs), func(i int) bool { return int32(runs[i].Start) > lim })) - 1
+		if itr.j >= 0 {
+			itr.v = min(lim, int32(runs[itr.j].Last))
+		}
+		return
+	}
+	itr.j = bitmapPrev(itr.c.bitmap(), lim)
+}
+
+// Next returns the next value in the bitmap, in descending order.
+// Returns eof as true if there are no values left in the iterator.
+func (itr *ReverseIterator) Next() (v uint64, eof bool) {
+	for itr.c != nil {
+		if itr.j < 0 {
+			// Reached the start of the container, move to the previous one.
+			if !itr.citer.Next() {
+				itr.c = nil
+				return 0, true
+			}
+			itr.key, itr.c = itr.citer.Value()
+			itr.position(MaxContainerVal)
+			continue
+		}
+
+		if itr.c.isArray() {
+			v = itr.key<<16 | uint64(itr.c.array()[itr.j])
+			itr.j--
+			return v, false
+		}
+
+		if itr.c.isRun() {
+			v = itr.key<<16 | uint64(itr.v)
+			runs := itr.c.runs()
+			if itr.v > int32(runs[itr.j].Start) {
+				itr.v--
+			} else if itr.j--; itr.j >= 0 {
+				itr.v = int32(runs[itr.j].Last)
+			}
+			return v, false
+		}
+
+		v = itr.key<<16 | uint64(itr.j)
+		itr.j = bitmapPrev(itr.c.bitmap(), itr.j-1)
+		return v, false
+	}
+	return 0, true
+}
+
+// bitmapPrev returns the index of the last bit set in bitmap at or before
+// i, or -1 if there isn't one.
+func bitmapPrev(bitmap []uint64, i int32) int32 {
+	if i < 0 {
+		return -1
+	}
+	w := i >> 6
+	word := bitmap[w] & (maxBitmap >> (63 - uint(i%64)))
+	for {
+		if word != 0 {
+			return w<<6 + 63 - int32(bits.LeadingZeros64(word))
+		}
+		if w--; w < 0 {
+			return -1
+		}
+		word = bitmap[w]
+	}
+}
+
 // ArrayMaxSize represents the maximum size of array containers.
 const ArrayMaxSize = 4096
 
@@ -3243,7 +3935,7 @@ func RunCountRange(runs []Interval16, start, end int32) (n int32) {
 			continue
 		}
 		// iv is after range
-		if end < int32(iv.Start) {
+		if end <= int32(iv.Start) {
 			break
 		}
 		// iv is superset of range
@@ -3251,7 +3943,7 @@ func RunCountRange(runs []Interval16, start, end int32) (n int32) {
 			return end - start
 		}
 		// iv is subset of range
-		if int32(iv.Start) >= start && int32(iv.Last) <= end {
+		if int32(iv.Start) >= start && int32(iv.Last) < end {
 			n += iv.runlen()
 		}
 		// iv overlaps beginning of range without being a subset
@@ -3716,6 +4408,103 @@ func (c *Container) runMax() uint16 {
 	return runs[len(runs)-1].Last
 }
 
+// Rank returns the number of values in the container which are less
+// than or equal to v.
+func (c *Container) Rank(v uint16) int32 {
+	if c == nil || c.N() == 0 {
+		return 0
+	}
+	if c.isArray() {
+		return c.arrayRank(v)
+	} else if c.isRun() {
+		return c.runRank(v)
+	} else {
+		return c.bitmapRank(v)
+	}
+}
+
+func (c *Container) arrayRank(v uint16) int32 {
+	i := search32(c.array(), v)
+	if i < 0 {
+		return -i - 1
+	}
+	return i + 1
+}
+
+func (c *Container) bitmapRank(v uint16) int32 {
+	bitmap := c.bitmap()
+	w := int(v / 64)
+	var n int
+	for _, word := range bitmap[:w] {
+		n += bits.OnesCount64(word)
+	}
+	// include v itself, so shift out everything above it.
+	n += bits.OnesCount64(bitmap[w] << (63 - v%64))
+	return int32(n)
+}
+
+func (c *Container) runRank(v uint16) int32 {
+	var n int32
+	for _, r := range c.runs() {
+		if r.Start > v {
+			break
+		}
+		if r.Last >= v {
+			return n + int32(v-r.Start) + 1
+		}
+		n += r.runlen()
+	}
+	return n
+}
+
+// Select returns the i-th (zero-based) smallest value in the container.
+// The second return value is false if i is out of range.
+func (c *Container) Select(i int32) (uint16, bool) {
+	if i < 0 || i >= c.N() {
+		return 0, false
+	}
+	if c.isArray() {
+		return c.array()[i], true
+	} else if c.isRun() {
+		return c.runSelect(i)
+	} else {
+		return c.bitmapSelect(i)
+	}
+}
+
+func (c *Container) bitmapSelect(i int32) (uint16, bool) {
+	for j, word := range c.bitmap() {
+		n := int32(bits.OnesCount64(word))
+		if i >= n {
+			i -= n
+			continue
+		}
+		return uint16(j*64 + selectBit(word, int(i))), true
+	}
+	return 0, false
+}
+
+func (c *Container) runSelect(i int32) (uint16, bool) {
+	for _, r := range c.runs() {
+		n := r.runlen()
+		if i >= n {
+			i -= n
+			continue
+		}
+		return r.Start + uint16(i), true
+	}
+	return 0, false
+}
+
+// selectBit returns the position of the i-th (zero-based) set bit in w.
+// w must have more than i bits set.
+func selectBit(w uint64, i int) int {
+	for ; i > 0; i-- {
+		w &= w - 1
+	}
+	return bits.TrailingZeros64(w)
+}
+
 // bitmapToArray converts from bitmap format to array format.
 func (c *Container) bitmapToArray() *Container {
 	statsHit("bitmapToArray")
@@ -5363,6 +6152,150 @@ func (c *Container) bitmapZeroRange(i, j uint64) {
 	c.setN(n)
 }
 
+// addRange sets every bit in the inclusive range [lo,hi], returning the
+// optimally encoded result.
+func (c *Container) addRange(lo, hi uint16) *Container {
+	if lo == 0 && hi == MaxContainerVal {
+		return fullContainer
+	}
+	if c.N() == 0 {
+		return NewContainerRun([]Interval16{{Start: lo, Last: hi}}).Optimize()
+	}
+	if int32(hi-lo)+1 == c.countRange(int32(lo), int32(hi)+1) {
+		return c.Optimize()
+	}
+	if c.isBitmap() {
+		c = c.Thaw()
+		c.bitmapSetRange(uint64(lo), uint64(hi)+1)
+		return c.Optimize()
+	}
+	if c.isArray() {
+		c = c.arrayToRun(0)
+	}
+	return NewContainerRun(runsAddRange(c.runs(), lo, hi)).Optimize()
+}
+
+// removeRange clears every bit in the inclusive range [lo,hi], returning
+// the optimally encoded result, or nil if nothing is left.
+func (c *Container) removeRange(lo, hi uint16) *Container {
+	if c.N() == 0 || (lo == 0 && hi == MaxContainerVal) {
+		return nil
+	}
+	if c.countRange(int32(lo), int32(hi)+1) == 0 {
+		return c.Optimize()
+	}
+	if c.isBitmap() {
+		c = c.Thaw()
+		c.bitmapZeroRange(uint64(lo), uint64(hi)+1)
+		return c.Optimize()
+	}
+	if c.isArray() {
+		c = c.arrayToRun(0)
+	}
+	return NewContainerRun(runsRemoveRange(c.runs(), lo, hi)).Optimize()
+}
+
+// flipRange negates every bit in the inclusive range [lo,hi], returning
+// the optimally encoded result, or nil if nothing is left.
+func (c *Container) flipRange(lo, hi uint16) *Container {
+	if c.N() == 0 {
+		return c.addRange(lo, hi)
+	}
+	if c.isBitmap() {
+		c = c.Thaw()
+		c.bitmapXorRange(uint64(lo), uint64(hi)+1)
+		return c.Optimize()
+	}
+	if c.isArray() {
+		c = c.arrayToRun(0)
+	}
+	return NewContainerRun(runsFlipRange(c.runs(), lo, hi)).Optimize()
+}
+
+// appendRun appends the inclusive interval [start,last] to runs, merging
+// it with the final run if they overlap or touch. Intervals must be
+// appended in order of their start.
+func appendRun(runs []Interval16, start, last int32) []Interval16 {
+	if n := len(runs); n > 0 && int32(runs[n-1].Last)+1 >= start {
+		if last > int32(runs[n-1].Last) {
+			runs[n-1].Last = uint16(last)
+		}
+		return runs
+	}
+	return append(runs, Interval16{Start: uint16(start), Last: uint16(last)})
+}
+
+// runsAddRange returns a new set of runs covering runs and [lo,hi].
+func runsAddRange(runs []Interval16, lo, hi uint16) []Interval16 {
+	out := make([]Interval16, 0, len(runs)+1)
+	added := false
+	for _, r := range runs {
+		if !added && r.Start > lo {
+			out = appendRun(out, int32(lo), int32(hi))
+			added = true
+		}
+		out = appendRun(out, int32(r.Start), int32(r.Last))
+	}
+	if !added {
+		out = appendRun(out, int32(lo), int32(hi))
+	}
+	return out
+}
+
+// runsRemoveRange returns a new set of runs covering runs less [lo,hi].
+func runsRemoveRange(runs []Interval16, lo, hi uint16) []Interval16 {
+	out := make([]Interval16, 0, len(runs)+1)
+	for _, r := range runs {
+		if r.Last < lo || r.Start > hi {
+			out = append(out, r)
+			continue
+		}
+		if r.Start < lo {
+			out = append(out, Interval16{Start: r.Start, Last: lo - 1})
+		}
+		if r.Last > hi {
+			out = append(out, Interval16{Start: hi + 1, Last: r.Last})
+		}
+	}
+	return out
+}
+
+// runsFlipRange returns a new set of runs covering runs with every bit in
+// [lo,hi] negated.
+func runsFlipRange(runs []Interval16, lo, hi uint16) []Interval16 {
+	out := make([]Interval16, 0, len(runs)+2)
+	// next is the lowest value within [lo,hi] not yet accounted for.
+	next := int32(lo)
+	for _, r := range runs {
+		if r.Last < lo {
+			out = appendRun(out, int32(r.Start), int32(r.Last))
+			continue
+		}
+		if r.Start > hi {
+			if next <= int32(hi) {
+				out = appendRun(out, next, int32(hi))
+				next = int32(hi) + 1
+			}
+			out = appendRun(out, int32(r.Start), int32(r.Last))
+			continue
+		}
+		if r.Start < lo {
+			out = appendRun(out, int32(r.Start), int32(lo)-1)
+		}
+		if int32(r.Start) > next {
+			out = appendRun(out, next, int32(r.Start)-1)
+		}
+		next = int32(r.Last) + 1
+		if r.Last > hi {
+			out = appendRun(out, int32(hi)+1, int32(r.Last))
+		}
+	}
+	if next <= int32(hi) {
+		out = appendRun(out, next, int32(hi))
+	}
+	return out
+}
+
 func typePair(ct1, ct2 byte) int {
 	return int((ct1 << 4) | ct2)
 }
@@ -5455,6 +6388,225 @@ func (c *Container) BitwiseCompare(c2 *Container) error {
 	return nil
 }
 
+// nextAbsent returns the lowest value at least equal to v which is not in
+// c, or false if there isn't one.
+func (c *Container) nextAbsent(v uint16) (uint16, bool) {
+	n := c.N()
+	if n == 0 {
+		return v, true
+	}
+	if n == MaxContainerVal+1 {
+		return 0, false
+	}
+	if c.isArray() {
+		a := c.array()
+		i := search32(a, v)
+		if i < 0 {
+			return v, true
+		}
+		for int(i)+1 < len(a) && a[i+1] == a[i]+1 {
+			i++
+		}
+		if a[i] == MaxContainerVal {
+			return 0, false
+		}
+		return a[i] + 1, true
+	}
+	if c.isRun() {
+		runs := c.runs()
+		i, contains := BinSearchRuns(v, runs)
+		if !contains {
+			return v, true
+		}
+		for int(i)+1 < len(runs) && runs[i+1].Start == runs[i].Last+1 {
+			i++
+		}
+		if runs[i].Last == MaxContainerVal {
+			return 0, false
+		}
+		return runs[i].Last + 1, true
+	}
+	// Count the trailing ones from v in its word, then look for the first
+	// word which isn't all ones.
+	bitmap := c.bitmap()
+	w, offset := int(v>>6), uint(v%64)
+	if ones := trailingZeroN(^(bitmap[w] >> offset)); offset+uint(ones) < 64 {
+		return v + uint16(ones), true
+	}
+	for w++; w < bitmapN; w++ {
+		if bitmap[w] != maxBitmap {
+			return uint16(w<<6 + trailingZeroN(^bitmap[w])), true
+		}
+	}
+	return 0, false
+}
+
+// forEachRun calls fn for each maximal run of consecutive values in c, in
+// ascending order, stopping early and returning false if fn does.
+func (c *Container) forEachRun(fn func(Interval16) bool) bool {
+	if c.N() == 0 {
+		return true
+	}
+	if c.isRun() {
+		for _, r := range c.runs() {
+			if !fn(r) {
+				return false
+			}
+		}
+		return true
+	}
+	if c.isArray() {
+		a := c.array()
+		for i := 0; i < len(a); {
+			j := i
+			for j+1 < len(a) && a[j+1] == a[j]+1 {
+				j++
+			}
+			if !fn(Interval16{Start: a[i], Last: a[j]}) {
+				return false
+			}
+			i = j + 1
+		}
+		return true
+	}
+	bitmap := c.bitmap()
+	for p := int32(0); p <= MaxContainerVal; {
+		// Find the next set bit at or after p...
+		w := p >> 6
+		word := bitmap[w] >> uint(p%64) << uint(p%64)
+		for word == 0 {
+			if w++; w == bitmapN {
+				return true
+			}
+			word = bitmap[w]
+		}
+		start := w<<6 + int32(trailingZeroN(word))
+
+		// ...then the next clear bit after that.
+		word = ^bitmap[w] >> uint(start%64) << uint(start%64)
+		for word == 0 {
+			if w++; w == bitmapN {
+				break
+			}
+			word = ^bitmap[w]
+		}
+		end := int32(MaxContainerVal + 1)
+		if w < bitmapN {
+			end = w<<6 + int32(trailingZeroN(word))
+		}
+		if !fn(Interval16{Start: uint16(start), Last: uint16(end - 1)}) {
+			return false
+		}
+		p = end
+	}
+	return true
+}
+
+// isSubsetOf reports whether every bit set in c is also set in other.
+func (c *Container) isSubsetOf(other *Container) bool {
+	n := c.N()
+	if n == 0 {
+		return true
+	}
+	if n > other.N() {
+		return false
+	}
+	if other.N() == MaxContainerVal+1 {
+		return true
+	}
+	switch typePair(c.typ(), other.typ()) {
+	case typePair(ContainerArray, ContainerArray):
+		return subsetArrayArray(c.array(), other.array())
+	case typePair(ContainerArray, ContainerBitmap):
+		return subsetArrayBitmap(c.array(), other.bitmap())
+	case typePair(ContainerArray, ContainerRun):
+		return subsetArrayRun(c.array(), other.runs())
+	case typePair(ContainerBitmap, ContainerBitmap):
+		return subsetBitmapBitmap(c.bitmap(), other.bitmap())
+	case typePair(ContainerRun, ContainerRun):
+		return subsetRunRun(c.runs(), other.runs())
+	case typePair(ContainerRun, ContainerBitmap):
+		return subsetRunBitmap(c.runs(), other.bitmap())
+	default:
+		return intersectionCount(c, other) == n
+	}
+}
+
+// subsetArrayArray reports whether every value in a1 is also in a2.
+func subsetArrayArray(a1, a2 []uint16) bool {
+	j := 0
+	for _, v := range a1 {
+		for j < len(a2) && a2[j] < v {
+			j++
+		}
+		if j == len(a2) || a2[j] != v {
+			return false
+		}
+		j++
+	}
+	return true
+}
+
+// subsetArrayRun reports whether every value in a is covered by a run in r.
+func subsetArrayRun(a []uint16, r []Interval16) bool {
+	j := 0
+	for _, v := range a {
+		for j < len(r) && r[j].Last < v {
+			j++
+		}
+		if j == len(r) || r[j].Start > v {
+			return false
+		}
+	}
+	return true
+}
+
+// subsetArrayBitmap reports whether every value in a is set in b.
+func subsetArrayBitmap(a []uint16, b []uint64) bool {
+	b = b[:bitmapN]
+	for _, v := range a {
+		if b[v>>6]>>(v&63)&1 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// subsetBitmapBitmap reports whether every bit set in b1 is set in b2.
+func subsetBitmapBitmap(b1, b2 []uint64) bool {
+	b1, b2 = b1[:bitmapN], b2[:bitmapN]
+	for i := range b1 {
+		if b1[i]&^b2[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// subsetRunRun reports whether every run in r1 is covered by a run in r2.
+func subsetRunRun(r1, r2 []Interval16) bool {
+	j := 0
+	for _, run := range r1 {
+		for j < len(r2) && r2[j].Last < run.Start {
+			j++
+		}
+		if j == len(r2) || r2[j].Start > run.Start || r2[j].Last < run.Last {
+			return false
+		}
+	}
+	return true
+}
+
+// subsetRunBitmap reports whether every run in r is set in b.
+func subsetRunBitmap(r []Interval16, b []uint64) bool {
+	for _, run := range r {
+		if BitmapCountRange(b, int32(run.Start), int32(run.Last)+1) != run.runlen() {
+			return false
+		}
+	}
+	return true
+}
+
 func unionArrayBitmap(a, b *Container) *Container {
 	output := b.Clone()
 	bitmap := output.bitmap()
@@ -6209,77 +7361,90 @@ func xorBitmapBitmap(a, b *Container) *Container {
 	return output
 }
 
-// shift() shifts the contents of c by one. It returns
-// the new container and a bool indicating whether a
-// carry bit was shifted out.
-func shift(c *Container) (*Container, bool) {
+// shiftContainer shifts the contents of c up by r. Values which remain
+// within the container are returned in lo, and values which overflow it
+// are returned in hi, relative to the start of the following container.
+func shiftContainer(c *Container, r uint16) (lo, hi *Container) {
 	if c.N() == 0 {
-		return nil, false
+		return nil, nil
+	}
+	if r == 0 {
+		return c.Freeze(), nil
 	}
 	if c.isArray() {
-		return shiftArray(c)
+		return shiftArrayBy(c, r)
 	} else if c.isRun() {
-		return shiftRun(c)
+		return shiftRunBy(c, r)
 	}
-	return shiftBitmap(c)
+	return shiftBitmapBy(c, r)
 }
 
-// shiftArray is an array-specific implementation of shift().
-func shiftArray(a *Container) (*Container, bool) {
-	statsHit("shift/Array")
-	carry := false
+// shiftArrayBy is an array-specific implementation of shiftContainer().
+func shiftArrayBy(a *Container, r uint16) (lo, hi *Container) {
+	statsHit("shiftBy/Array")
 	aa := a.array()
-	output := make([]uint16, 0, len(aa))
-	for _, v := range aa {
-		if v+1 == 0 { // overflow
-			carry = true
-		} else {
-			output = append(output, v+1)
-		}
+	// Values at or above split overflow into the next container.
+	i := search32(aa, -r)
+	if i < 0 {
+		i = -i - 1
 	}
-	return NewContainerArray(output), carry
-}
-
-// shiftBitmap is a bitmap-specific implementation of shift().
-func shiftBitmap(a *Container) (*Container, bool) {
-	statsHit("shift/Bitmap")
-	carry := uint64(0)
-	output := NewContainerBitmapN(nil, 0)
-	ba, bo := a.bitmap(), output.bitmap()
-	lastCarry := uint64(0)
-	for i, v := range ba {
-		carry = v >> 63
-		v = v<<1 | lastCarry
-		bo[i] = v
-		lastCarry = carry
+	loa, hia := make([]uint16, i), make([]uint16, int32(len(aa))-i)
+	for j, v := range aa[:i] {
+		loa[j] = v + r
+	}
+	for j, v := range aa[i:] {
+		hia[j] = v + r
+	}
+	if len(loa) > 0 {
+		lo = NewContainerArray(loa).Optimize()
+	}
+	if len(hia) > 0 {
+		hi = NewContainerArray(hia).Optimize()
 	}
-	output.setN(a.N() - int32(carry))
-	return output, carry != 0
+	return lo, hi
 }
 
-// shiftRun is a run-specific implementation of shift().
-func shiftRun(a *Container) (*Container, bool) {
-	statsHit("shift/Run")
-	carry := false
-	ra := a.runs()
-	ro := make([]Interval16, 0, len(ra))
-
-	for _, v := range ra {
-		if v.Start+1 == 0 { // final run was 1 bit on container edge
-			carry = true
-			break
-		} else if v.Last+1 == 0 { // final run ends on container edge
-			v.Start++
-			carry = true
+// shiftRunBy is a run-specific implementation of shiftContainer().
+func shiftRunBy(a *Container, r uint16) (lo, hi *Container) {
+	statsHit("shiftBy/Run")
+	var lor, hir []Interval16
+	for _, v := range a.runs() {
+		start, last := int32(v.Start)+int32(r), int32(v.Last)+int32(r)
+		if last <= MaxContainerVal {
+			lor = append(lor, Interval16{Start: uint16(start), Last: uint16(last)})
+		} else if start > MaxContainerVal {
+			hir = append(hir, Interval16{Start: uint16(start), Last: uint16(last)})
 		} else {
-			v.Start++
-			v.Last++
-			carry = false
+			lor = append(lor, Interval16{Start: uint16(start), Last: MaxContainerVal})
+			hir = append(hir, Interval16{Start: 0, Last: uint16(last)})
 		}
-		ro = append(ro, v)
 	}
+	if len(lor) > 0 {
+		lo = NewContainerRun(lor).Optimize()
+	}
+	if len(hir) > 0 {
+		hi = NewContainerRun(hir).Optimize()
+	}
+	return lo, hi
+}
 
-	return NewContainerRun(ro), carry
+// shiftBitmapBy is a bitmap-specific implementation of shiftContainer().
+func shiftBitmapBy(a *Container, r uint16) (lo, hi *Container) {
+	statsHit("shiftBy/Bitmap")
+	out := make([]uint64, 2*bitmapN)
+	words, bits := int(r/64), r%64
+	for i, w := range a.bitmap() {
+		if w == 0 {
+			continue
+		}
+		out[i+words] |= w << bits
+		if bits != 0 {
+			out[i+words+1] |= w >> (64 - bits)
+		}
+	}
+	lo = NewContainerBitmap(-1, out[:bitmapN:bitmapN]).Optimize()
+	hi = NewContainerBitmap(-1, out[bitmapN:]).Optimize()
+	return lo, hi
 }
 
 // opType represents a type of operation.
@@ -7201,6 +8366,38 @@ func (b *Bitmap) DifferenceInPlace(others ...*Bitmap) {
 	target.Containers.Repair()
 }
 
+// XorInPlace stores the bitwise exclusive or of b and others into b. The
+// others will be left unchanged.
+func (b *Bitmap) XorInPlace(others ...*Bitmap) {
+	for _, other := range others {
+		// b ^ b is empty, and we can't iterate over the containers we
+		// are modifying.
+		if other == b {
+			b.Containers.Reset()
+			continue
+		}
+		otherIter, _ := other.Containers.Iterator(0)
+		for otherIter.Next() {
+			key, otherContainer := otherIter.Value()
+			// note: a nil container is valid, and has N == 0.
+			if otherContainer.N() == 0 {
+				continue
+			}
+			curContainer := b.Containers.Get(key)
+			if curContainer.N() == 0 {
+				b.Containers.Put(key, otherContainer.Freeze())
+				continue
+			}
+			curContainer = curContainer.Thaw().XorInPlace(otherContainer)
+			if curContainer.N() == 0 {
+				b.Containers.Remove(key)
+			} else {
+				b.Containers.Put(key, curContainer)
+			}
+		}
+	}
+}
+
 func (c *Container) DifferenceInPlace(other *Container) *Container {
 	if other == nil {
 		return c
@@ -7591,6 +8788,253 @@ func differenceRunRunInPlace(c, other *Container) *Container {
 	return c
 }
 
+// XorInPlace yields a container containing the bits set in exactly one
+// of c and other. It may, or may not, modify c, so it must not be frozen.
+func (c *Container) XorInPlace(other *Container) *Container {
+	if other == nil {
+		return c
+	}
+	if other.isArray() {
+		if c.isArray() {
+			return xorArrayArrayInPlace(c, other)
+		} else if c.isBitmap() {
+			return xorBitmapArrayInPlace(c, other)
+		} else if c.isRun() {
+			return xorRunArrayInPlace(c, other)
+		}
+	} else if other.isBitmap() {
+		if c.isArray() {
+			return xorArrayBitmapInPlace(c, other)
+		} else if c.isBitmap() {
+			return xorBitmapBitmapInPlace(c, other)
+		} else if c.isRun() {
+			return xorRunBitmapInPlace(c, other)
+		}
+	} else if other.isRun() {
+		if c.isArray() {
+			return xorArrayRunInPlace(c, other)
+		} else if c.isBitmap() {
+			return xorBitmapRunInPlace(c, other)
+		} else if c.isRun() {
+			return xorRunRunInPlace(c, other)
+		}
+	}
+	return c
+}
+
+func xorArrayArrayInPlace(c, other *Container) *Container {
+	statsHit("xorInPlace/ArrayArray")
+	aa, ab := c.array(), other.array()
+	if len(ab) == 0 {
+		return c
+	}
+	// The result can be larger than either input, so it can't be built
+	// in aa without clobbering values we haven't read yet.
+	output := make([]uint16, 0, len(aa)+len(ab))
+	i, j := 0, 0
+	for i < len(aa) && j < len(ab) {
+		va, vb := aa[i], ab[j]
+		if va < vb {
+			output = append(output, va)
+			i++
+		} else if va > vb {
+			output = append(output, vb)
+			j++
+		} else {
+			i, j = i+1, j+1
+		}
+	}
+	output = append(output, aa[i:]...)
+	output = append(output, ab[j:]...)
+	c.setArray(output)
+	c.setN(int32(len(output)))
+	if c.N() > ArrayMaxSize {
+		c = c.arrayToBitmap()
+	}
+	return c
+}
+
+func xorArrayBitmapInPlace(c, other *Container) *Container {
+	statsHit("xorInPlace/ArrayBitmap")
+	aa := c.array()
+	bitmap := make([]uint64, bitmapN)
+	copy(bitmap, other.bitmap())
+	n := other.N()
+	for _, v := range aa {
+		mask := uint64(1) << (v % 64)
+		if bitmap[v/64]&mask != 0 {
+			n--
+		} else {
+			n++
+		}
+		bitmap[v/64] ^= mask
+	}
+	c.setTyp(ContainerBitmap)
+	c.setMapped(false)
+	c.setBitmap(bitmap)
+	c.setN(n)
+	if n < ArrayMaxSize {
+		c = c.bitmapToArray()
+	}
+	return c
+}
+
+func xorArrayRunInPlace(c, other *Container) *Container {
+	statsHit("xorInPlace/ArrayRun")
+	runs := xorRuns(arrayRuns(c.array()), other.runs())
+	c.setTyp(ContainerRun)
+	c.setMapped(false)
+	c.setRuns(runs)
+	c.setN(runsN(runs))
+	return c.Optimize()
+}
+
+func xorBitmapArrayInPlace(c, other *Container) *Container {
+	statsHit("xorInPlace/BitmapArray")
+	bitmap := c.bitmap()
+	n := c.N()
+	for _, v := range other.array() {
+		mask := uint64(1) << (v % 64)
+		if bitmap[v/64]&mask != 0 {
+			n--
+		} else {
+			n++
+		}
+		bitmap[v/64] ^= mask
+	}
+	c.setN(n)
+	if n < ArrayMaxSize {
+		c = c.bitmapToArray()
+	}
+	return c
+}
+
+func xorBitmapBitmapInPlace(c, other *Container) *Container {
+	statsHit("xorInPlace/BitmapBitmap")
+	// local variables added to prevent BCE checks in loop
+	// see https://go101.org/article/bounds-check-elimination.html
+	var (
+		ab = c.bitmap()[:bitmapN]
+		bb = other.bitmap()[:bitmapN]
+		n  int32
+	)
+
+	for i := 0; i < bitmapN; i++ {
+		ab[i] ^= bb[i]
+		n += int32(popcount(ab[i]))
+	}
+	c.setN(n)
+	if n < ArrayMaxSize {
+		c = c.bitmapToArray()
+	}
+	return c
+}
+
+func xorBitmapRunInPlace(c, other *Container) *Container {
+	statsHit("xorInPlace/BitmapRun")
+	for _, run := range other.runs() {
+		c.bitmapXorRange(uint64(run.Start), uint64(run.Last)+1)
+	}
+	return c.Optimize()
+}
+
+func xorRunArrayInPlace(c, other *Container) *Container {
+	statsHit("xorInPlace/RunArray")
+	runs := xorRuns(c.runs(), arrayRuns(other.array()))
+	c.setRuns(runs)
+	c.setN(runsN(runs))
+	return c.Optimize()
+}
+
+func xorRunBitmapInPlace(c, other *Container) *Container {
+	statsHit("xorInPlace/RunBitmap")
+	ra := c.runs()
+	bitmap := make([]uint64, bitmapN)
+	copy(bitmap, other.bitmap())
+	c.setTyp(ContainerBitmap)
+	c.setMapped(false)
+	c.setBitmap(bitmap)
+	c.setN(other.N())
+	for _, run := range ra {
+		c.bitmapXorRange(uint64(run.Start), uint64(run.Last)+1)
+	}
+	return c.Optimize()
+}
+
+func xorRunRunInPlace(c, other *Container) *Container {
+	statsHit("xorInPlace/RunRun")
+	runs := xorRuns(c.runs(), other.runs())
+	c.setRuns(runs)
+	c.setN(runsN(runs))
+	return c.Optimize()
+}
+
+// xorRuns returns the runs covering values which are in exactly one of
+// a and b. It sweeps the boundaries of both sets of runs in order,
+// tracking whether each side is currently inside a run.
+func xorRuns(a, b []Interval16) []Interval16 {
+	output := make([]Interval16, 0, len(a)+len(b))
+	// boundary k of runs is the start of run k/2 for even k, and one past
+	// its end for odd k.
+	boundary := func(runs []Interval16, k int) int32 {
+		if k%2 == 0 {
+			return int32(runs[k/2].Start)
+		}
+		return int32(runs[k/2].Last) + 1
+	}
+	i, j := 0, 0
+	na, nb := 2*len(a), 2*len(b)
+	inA, inB, on := false, false, false
+	var start int32
+	for i < na || j < nb {
+		p := int32(MaxContainerVal + 2)
+		if i < na {
+			p = boundary(a, i)
+		}
+		if j < nb {
+			if q := boundary(b, j); q < p {
+				p = q
+			}
+		}
+		for ; i < na && boundary(a, i) == p; i++ {
+			inA = !inA
+		}
+		for ; j < nb && boundary(b, j) == p; j++ {
+			inB = !inB
+		}
+		if now := inA != inB; now != on {
+			if now {
+				start = p
+			} else {
+				output = append(output, Interval16{Start: uint16(start), Last: uint16(p - 1)})
+			}
+			on = now
+		}
+	}
+	return output
+}
+
+// arrayRuns returns the runs covering the values in a sorted array.
+func arrayRuns(a []uint16) []Interval16 {
+	var runs []Interval16
+	for _, v := range a {
+		if n := len(runs); n > 0 && int32(runs[n-1].Last)+1 == int32(v) {
+			runs[n-1].Last = v
+			continue
+		}
+		runs = append(runs, Interval16{Start: v, Last: v})
+	}
+	return runs
+}
+
+// runsN returns the number of values covered by runs.
+func runsN(runs []Interval16) (n int32) {
+	for _, run := range runs {
+		n += run.runlen()
+	}
+	return n
+}
+
 // Roaring encodes the bitmap in the Pilosa roaring
 // format. Convenience wrapper around WriteTo.
 func (b *Bitmap) Roaring() []byte {
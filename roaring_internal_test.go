@@ -10,6 +10,7 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
 
@@ -211,6 +212,11 @@ func TestRunCountRange(t *testing.T) {
 		t.Fatalf("should get 6 from interval equal to range, but got: %v", cnt)
 	}
 
+	cnt = RunCountRange(c.runs(), 2, 11)
+	if cnt != 6 {
+		t.Fatalf("should get 6 from interval ending at the end of range, but got: %v", cnt)
+	}
+
 	c, _ = c.add(17)
 	c, _ = c.add(19)
 	c, _ = c.add(18)
@@ -2942,6 +2948,10 @@ func differenceInPlaceWrapper(a, b *Container) *Container {
 	return a
 }
 
+func xorInPlaceWrapper(a, b *Container) *Container {
+	return a.Clone().XorInPlace(b)
+}
+
 func intersectInPlaceWrapper(a, b *Container) *Container {
 	return a.Clone().intersectInPlace(b)
 }
@@ -2971,6 +2981,174 @@ func TestContainerBitwiseCompare(t *testing.T) {
 	}
 }
 
+func TestContainerRankSelect(t *testing.T) {
+	cts := setupContainerTests()
+
+	for typ, containers := range cts {
+		for name, c := range containers {
+			vals := c.Slice()
+			for i, v := range vals {
+				if got := c.Rank(v); got != int32(i+1) {
+					t.Fatalf("type %d, %s: Rank(%d) expected %d, got %d", typ, name, v, i+1, got)
+				}
+				got, ok := c.Select(int32(i))
+				if !ok || got != v {
+					t.Fatalf("type %d, %s: Select(%d) expected %d, got %d/%v", typ, name, i, v, got, ok)
+				}
+			}
+			if got := c.Rank(MaxContainerVal); got != c.N() {
+				t.Fatalf("type %d, %s: Rank(max) expected %d, got %d", typ, name, c.N(), got)
+			}
+			if _, ok := c.Select(c.N()); ok {
+				t.Fatalf("type %d, %s: Select(N) should fail", typ, name)
+			}
+		}
+	}
+}
+
+func TestContainerRangeOps(t *testing.T) {
+	cts := setupContainerTests()
+	ranges := [][2]uint16{{0, 0}, {0, 9}, {5, 70}, {63, 64}, {100, 5000}, {4000, 65534}, {65535, 65535}, {0, 65535}}
+	ops := map[string]struct {
+		fn    func(c *Container, lo, hi uint16) *Container
+		apply func(set bool) bool
+	}{
+		"add":    {(*Container).addRange, func(bool) bool { return true }},
+		"remove": {(*Container).removeRange, func(bool) bool { return false }},
+		"flip":   {(*Container).flipRange, func(set bool) bool { return !set }},
+	}
+
+	for typ, containers := range cts {
+		for name, c := range containers {
+			for opName, op := range ops {
+				for _, r := range ranges {
+					var bits [MaxContainerVal + 1]bool
+					for _, v := range c.Slice() {
+						bits[v] = true
+					}
+					for v := int(r[0]); v <= int(r[1]); v++ {
+						bits[v] = op.apply(bits[v])
+					}
+					var exp []uint16
+					for v, set := range bits {
+						if set {
+							exp = append(exp, uint16(v))
+						}
+					}
+
+					got := op.fn(c.Clone(), r[0], r[1])
+					if !slices.Equal(got.Slice(), exp) {
+						t.Fatalf("type %d, %s: %s(%d, %d) got %d values, expected %d", typ, name, opName, r[0], r[1], got.N(), len(exp))
+					}
+					if len(exp) == 0 {
+						if got != nil {
+							t.Fatalf("type %d, %s: %s(%d, %d) expected nil container", typ, name, opName, r[0], r[1])
+						}
+						continue
+					}
+					if want := NewContainerArray(exp).Optimize(); got.typ() != want.typ() {
+						t.Fatalf("type %d, %s: %s(%d, %d) got type %d, expected %d", typ, name, opName, r[0], r[1], got.typ(), want.typ())
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestShiftContainer(t *testing.T) {
+	cts := setupContainerTests()
+	for typ, containers := range cts {
+		for name, c := range containers {
+			vals := c.Slice()
+			for _, r := range []uint16{0, 1, 17, 64, 65, 4096, 65535} {
+				var expLo, expHi []uint16
+				for _, v := range vals {
+					if int(v)+int(r) <= MaxContainerVal {
+						expLo = append(expLo, v+r)
+					} else {
+						expHi = append(expHi, v+r)
+					}
+				}
+				lo, hi := shiftContainer(c, r)
+				if !slices.Equal(lo.Slice(), expLo) || !slices.Equal(hi.Slice(), expHi) {
+					t.Fatalf("type %d, %s: shift by %d got %d/%d values, expected %d/%d", typ, name, r, lo.N(), hi.N(), len(expLo), len(expHi))
+				}
+			}
+		}
+	}
+}
+
+func TestContainerIsSubsetOf(t *testing.T) {
+	cts := setupContainerTests()
+	for t1, containers := range cts {
+		for name, c := range containers {
+			for t2, others := range cts {
+				for otherName, other := range others {
+					exp := true
+					for _, v := range c.Slice() {
+						if !other.Contains(v) {
+							exp = false
+							break
+						}
+					}
+					if got := c.isSubsetOf(other); got != exp {
+						t.Fatalf("%d/%s subset of %d/%s: expected %v, got %v", t1, name, t2, otherName, exp, got)
+					}
+					if n := testing.AllocsPerRun(1, func() { c.isSubsetOf(other) }); n != 0 {
+						t.Fatalf("%d/%s subset of %d/%s: expected no allocations, got %v", t1, name, t2, otherName, n)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestContainerForEachRun(t *testing.T) {
+	cts := setupContainerTests()
+	for typ, containers := range cts {
+		for name, c := range containers {
+			var runs []Interval16
+			c.forEachRun(func(r Interval16) bool {
+				runs = append(runs, r)
+				return true
+			})
+			var got []uint16
+			for i, r := range runs {
+				if i > 0 && int(runs[i-1].Last)+1 >= int(r.Start) {
+					t.Fatalf("type %d, %s: runs %v and %v aren't maximal", typ, name, runs[i-1], r)
+				}
+				for v := int(r.Start); v <= int(r.Last); v++ {
+					got = append(got, uint16(v))
+				}
+			}
+			if !slices.Equal(got, c.Slice()) {
+				t.Fatalf("type %d, %s: runs cover %d values, expected %d", typ, name, len(got), c.N())
+			}
+		}
+	}
+}
+
+func TestContainerNextAbsent(t *testing.T) {
+	cts := setupContainerTests()
+	for typ, containers := range cts {
+		for name, c := range containers {
+			for _, v := range []uint16{0, 1, 2, 63, 64, 100, 32767, 65534, 65535} {
+				exp, ok := int(v), true
+				for exp <= MaxContainerVal && c.Contains(uint16(exp)) {
+					exp++
+				}
+				if exp > MaxContainerVal {
+					ok = false
+				}
+				got, gotOK := c.nextAbsent(v)
+				if gotOK != ok || (ok && int(got) != exp) {
+					t.Fatalf("type %d, %s: nextAbsent(%d): expected %d/%v, got %d/%v", typ, name, v, exp, ok, got, gotOK)
+				}
+			}
+		}
+	}
+}
+
 func TestContainerCombinations(t *testing.T) {
 
 	cts := setupContainerTests()
@@ -3636,6 +3814,117 @@ func TestContainerCombinations(t *testing.T) {
 		{xor, "evenBitsSet", "oddBitsSet", "full"},
 		{xor, "evenBitsSet", "evenBitsSet", "empty"},
 
+		// xorInPlace
+		{xorInPlaceWrapper, "empty", "empty", "empty"},
+		{xorInPlaceWrapper, "empty", "full", "full"},
+		{xorInPlaceWrapper, "empty", "firstBitSet", "firstBitSet"},
+		{xorInPlaceWrapper, "empty", "lastBitSet", "lastBitSet"},
+		{xorInPlaceWrapper, "empty", "firstBitUnset", "firstBitUnset"},
+		{xorInPlaceWrapper, "empty", "lastBitUnset", "lastBitUnset"},
+		{xorInPlaceWrapper, "empty", "innerBitsSet", "innerBitsSet"},
+		{xorInPlaceWrapper, "empty", "outerBitsSet", "outerBitsSet"},
+		{xorInPlaceWrapper, "empty", "oddBitsSet", "oddBitsSet"},
+		{xorInPlaceWrapper, "empty", "evenBitsSet", "evenBitsSet"},
+		//
+		{xorInPlaceWrapper, "full", "empty", "full"},
+		{xorInPlaceWrapper, "full", "full", "empty"},
+		{xorInPlaceWrapper, "full", "firstBitSet", "firstBitUnset"},
+		{xorInPlaceWrapper, "full", "lastBitSet", "lastBitUnset"},
+		{xorInPlaceWrapper, "full", "firstBitUnset", "firstBitSet"},
+		{xorInPlaceWrapper, "full", "lastBitUnset", "lastBitSet"},
+		{xorInPlaceWrapper, "full", "innerBitsSet", "outerBitsSet"},
+		{xorInPlaceWrapper, "full", "outerBitsSet", "innerBitsSet"},
+		{xorInPlaceWrapper, "full", "oddBitsSet", "evenBitsSet"},
+		{xorInPlaceWrapper, "full", "evenBitsSet", "oddBitsSet"},
+		//
+		{xorInPlaceWrapper, "firstBitSet", "empty", "firstBitSet"},
+		{xorInPlaceWrapper, "firstBitSet", "full", "firstBitUnset"},
+		{xorInPlaceWrapper, "firstBitSet", "firstBitSet", "empty"},
+		{xorInPlaceWrapper, "firstBitSet", "lastBitSet", "outerBitsSet"},
+		{xorInPlaceWrapper, "firstBitSet", "firstBitUnset", "full"},
+		{xorInPlaceWrapper, "firstBitSet", "lastBitUnset", "innerBitsSet"},
+		{xorInPlaceWrapper, "firstBitSet", "innerBitsSet", "lastBitUnset"},
+		{xorInPlaceWrapper, "firstBitSet", "outerBitsSet", "lastBitSet"},
+		//{xorInPlaceWrapper, "firstBitSet", "oddBitsSet", ""},
+		//{xorInPlaceWrapper, "firstBitSet", "evenBitsSet", ""},
+		//
+		{xorInPlaceWrapper, "lastBitSet", "empty", "lastBitSet"},
+		{xorInPlaceWrapper, "lastBitSet", "full", "lastBitUnset"},
+		{xorInPlaceWrapper, "lastBitSet", "firstBitSet", "outerBitsSet"},
+		{xorInPlaceWrapper, "lastBitSet", "lastBitSet", "empty"},
+		{xorInPlaceWrapper, "lastBitSet", "firstBitUnset", "innerBitsSet"},
+		{xorInPlaceWrapper, "lastBitSet", "lastBitUnset", "full"},
+		{xorInPlaceWrapper, "lastBitSet", "innerBitsSet", "firstBitUnset"},
+		{xorInPlaceWrapper, "lastBitSet", "outerBitsSet", "firstBitSet"},
+		//{xorInPlaceWrapper, "lastBitSet", "oddBitsSet", ""},
+		//{xorInPlaceWrapper, "lastBitSet", "evenBitsSet", ""},
+		//
+		{xorInPlaceWrapper, "firstBitUnset", "empty", "firstBitUnset"},
+		{xorInPlaceWrapper, "firstBitUnset", "full", "firstBitSet"},
+		{xorInPlaceWrapper, "firstBitUnset", "firstBitSet", "full"},
+		{xorInPlaceWrapper, "firstBitUnset", "lastBitSet", "innerBitsSet"},
+		{xorInPlaceWrapper, "firstBitUnset", "firstBitUnset", "empty"},
+		{xorInPlaceWrapper, "firstBitUnset", "lastBitUnset", "outerBitsSet"},
+		{xorInPlaceWrapper, "firstBitUnset", "innerBitsSet", "lastBitSet"},
+		{xorInPlaceWrapper, "firstBitUnset", "outerBitsSet", "lastBitUnset"},
+		//{xorInPlaceWrapper, "firstBitUnset", "oddBitsSet", ""},
+		//{xorInPlaceWrapper, "firstBitUnset", "evenBitsSet", ""},
+		//
+		{xorInPlaceWrapper, "lastBitUnset", "empty", "lastBitUnset"},
+		{xorInPlaceWrapper, "lastBitUnset", "full", "lastBitSet"},
+		{xorInPlaceWrapper, "lastBitUnset", "firstBitSet", "innerBitsSet"},
+		{xorInPlaceWrapper, "lastBitUnset", "lastBitSet", "full"},
+		{xorInPlaceWrapper, "lastBitUnset", "firstBitUnset", "outerBitsSet"},
+		{xorInPlaceWrapper, "lastBitUnset", "lastBitUnset", "empty"},
+		{xorInPlaceWrapper, "lastBitUnset", "innerBitsSet", "firstBitSet"},
+		{xorInPlaceWrapper, "lastBitUnset", "outerBitsSet", "firstBitUnset"},
+		//{xorInPlaceWrapper, "lastBitUnset", "oddBitsSet", ""},
+		//{xorInPlaceWrapper, "lastBitUnset", "evenBitsSet", ""},
+		//
+		{xorInPlaceWrapper, "innerBitsSet", "empty", "innerBitsSet"},
+		{xorInPlaceWrapper, "innerBitsSet", "full", "outerBitsSet"},
+		{xorInPlaceWrapper, "innerBitsSet", "firstBitSet", "lastBitUnset"},
+		{xorInPlaceWrapper, "innerBitsSet", "lastBitSet", "firstBitUnset"},
+		{xorInPlaceWrapper, "innerBitsSet", "firstBitUnset", "lastBitSet"},
+		{xorInPlaceWrapper, "innerBitsSet", "lastBitUnset", "firstBitSet"},
+		{xorInPlaceWrapper, "innerBitsSet", "innerBitsSet", "empty"},
+		{xorInPlaceWrapper, "innerBitsSet", "outerBitsSet", "full"},
+		//{xorInPlaceWrapper, "innerBitsSet", "oddBitsSet", ""},
+		//{xorInPlaceWrapper, "innerBitsSet", "evenBitsSet", ""},
+		//
+		{xorInPlaceWrapper, "outerBitsSet", "empty", "outerBitsSet"},
+		{xorInPlaceWrapper, "outerBitsSet", "full", "innerBitsSet"},
+		{xorInPlaceWrapper, "outerBitsSet", "firstBitSet", "lastBitSet"},
+		{xorInPlaceWrapper, "outerBitsSet", "lastBitSet", "firstBitSet"},
+		{xorInPlaceWrapper, "outerBitsSet", "firstBitUnset", "lastBitUnset"},
+		{xorInPlaceWrapper, "outerBitsSet", "lastBitUnset", "firstBitUnset"},
+		{xorInPlaceWrapper, "outerBitsSet", "innerBitsSet", "full"},
+		{xorInPlaceWrapper, "outerBitsSet", "outerBitsSet", "empty"},
+		//{xorInPlaceWrapper, "outerBitsSet", "oddBitsSet", ""},
+		//{xorInPlaceWrapper, "outerBitsSet", "evenBitsSet", ""},
+		//
+		{xorInPlaceWrapper, "oddBitsSet", "empty", "oddBitsSet"},
+		{xorInPlaceWrapper, "oddBitsSet", "full", "evenBitsSet"},
+		//{xorInPlaceWrapper, "oddBitsSet", "firstBitSet", ""},
+		//{xorInPlaceWrapper, "oddBitsSet", "lastBitSet", ""},
+		//{xorInPlaceWrapper, "oddBitsSet", "firstBitUnset", ""},
+		//{xorInPlaceWrapper, "oddBitsSet", "lastBitUnset", ""},
+		//{xorInPlaceWrapper, "oddBitsSet", "innerBitsSet", ""},
+		//{xorInPlaceWrapper, "oddBitsSet", "outerBitsSet", ""},
+		{xorInPlaceWrapper, "oddBitsSet", "oddBitsSet", "empty"},
+		{xorInPlaceWrapper, "oddBitsSet", "evenBitsSet", "full"},
+		//
+		{xorInPlaceWrapper, "evenBitsSet", "empty", "evenBitsSet"},
+		{xorInPlaceWrapper, "evenBitsSet", "full", "oddBitsSet"},
+		//{xorInPlaceWrapper, "evenBitsSet", "firstBitSet", ""},
+		//{xorInPlaceWrapper, "evenBitsSet", "lastBitSet", ""},
+		//{xorInPlaceWrapper, "evenBitsSet", "firstBitUnset", ""},
+		//{xorInPlaceWrapper, "evenBitsSet", "lastBitUnset", ""},
+		//{xorInPlaceWrapper, "evenBitsSet", "innerBitsSet", ""},
+		//{xorInPlaceWrapper, "evenBitsSet", "outerBitsSet", ""},
+		{xorInPlaceWrapper, "evenBitsSet", "oddBitsSet", "full"},
+		{xorInPlaceWrapper, "evenBitsSet", "evenBitsSet", "empty"},
+
 		// flip
 		{flip, "empty", "", "full"},
 		{flip, "full", "", "empty"},
@@ -3887,10 +4176,31 @@ func newTestBitmapContainer() *Container {
 	return NewContainerBitmap(0, nil)
 }
 
+// checkShiftByOne checks that shifting c up by one yields the values in
+// exp, with a carry into the next container if carry is set.
+func checkShiftByOne(t *testing.T, i int, c *Container, exp []uint16, carry bool) {
+	t.Helper()
+	lo, hi := shiftContainer(c, 1)
+	if got := lo.Slice(); !slices.Equal(got, exp) {
+		t.Fatalf("test #%v expected %v, but got %v", i, exp, got)
+	}
+	if lo.N() != int32(len(exp)) {
+		t.Fatalf("test #%v expected count %d, but got %d", i, len(exp), lo.N())
+	}
+	var expHi []uint16
+	if carry {
+		expHi = []uint16{0}
+	}
+	if got := hi.Slice(); !slices.Equal(got, expHi) {
+		t.Fatalf("test #%v expected carry %v, but got %v", i, expHi, got)
+	}
+}
+
 func TestShiftArray(t *testing.T) {
 	tests := []struct {
 		array []uint16
 		exp   []uint16
+		carry bool
 	}{
 		{
 			array: []uint16{1},
@@ -3907,25 +4217,12 @@ func TestShiftArray(t *testing.T) {
 		{
 			array: []uint16{65535},
 			exp:   []uint16{},
+			carry: true,
 		},
 	}
 
 	for i, test := range tests {
-		a := NewContainerArray(test.array)
-		ret1, _ := shift(a)      // test generic shift function
-		ret2, _ := shiftArray(a) // test array-specific shift function
-		// accept nil *Container as valid substitute for empty array
-		if ret1 == nil {
-			ret1 = NewContainerArray(nil)
-		}
-		if ret2 == nil {
-			ret2 = NewContainerArray(nil)
-		}
-		if !reflect.DeepEqual(ret1.array(), test.exp) {
-			t.Fatalf("test #%v shift() expected %v, but got %v", i, test.exp, ret1.array())
-		} else if !reflect.DeepEqual(ret2.array(), test.exp) {
-			t.Fatalf("test #%v shiftArray() expected %v, but got %v", i, test.exp, ret2.array())
-		}
+		checkShiftByOne(t, i, NewContainerArray(test.array), test.exp, test.carry)
 	}
 }
 
@@ -3934,6 +4231,7 @@ func TestShiftBitmap(t *testing.T) {
 	tests := []struct {
 		bitmap []uint64
 		exp    []uint64
+		carry  bool
 	}{
 		{
 			bitmap: bitmapFirstBitSet(),
@@ -3942,6 +4240,7 @@ func TestShiftBitmap(t *testing.T) {
 		{
 			bitmap: bitmapLastBitSet(),
 			exp:    bitmapEmpty(),
+			carry:  true,
 		},
 		{
 			bitmap: bitmapLastBitFirstRowSet(),
@@ -3951,56 +4250,35 @@ func TestShiftBitmap(t *testing.T) {
 
 	for i, test := range tests {
 		a := NewContainerBitmap(-1, test.bitmap)
-		ret1, _ := shift(a)       // test generic shift function
-		ret2, _ := shiftBitmap(a) // test bitmap-specific shift function
-		e := NewContainerBitmap(-1, test.exp)
-		if !reflect.DeepEqual(ret1.bitmap(), e.bitmap()) {
-			t.Fatalf("test #%v shift() expected %v, but got %v", i, e.bitmap(), ret1.bitmap())
-		} else if !reflect.DeepEqual(ret2.bitmap(), test.exp) {
-			t.Fatalf("test #%v shiftBitmap() expected %v, but got %v", i, e.bitmap(), ret2.bitmap())
-		}
+		checkShiftByOne(t, i, a, NewContainerBitmap(-1, test.exp).Slice(), test.carry)
 	}
 }
+
 func TestShiftRun(t *testing.T) {
 	tests := []struct {
 		runs  []Interval16
-		n     int32
-		en    int32
 		exp   []Interval16
 		carry bool
 	}{
 		{
 			runs:  []Interval16{{Start: 5, Last: 10}},
-			n:     5,
-			en:    5,
 			exp:   []Interval16{{Start: 6, Last: 11}},
 			carry: false,
 		},
 		{
 			runs:  []Interval16{{Start: 5, Last: 65535}},
-			n:     65530,
-			en:    65529,
 			exp:   []Interval16{{Start: 6, Last: 65535}},
 			carry: true,
 		},
 		{
 			runs:  []Interval16{{Start: 65535, Last: 65535}},
-			n:     1,
-			en:    0,
 			exp:   []Interval16{},
 			carry: true,
 		},
 	}
 
 	for i, test := range tests {
-		a := NewContainerRun(test.runs)
-		ret1, c1 := shift(a)    // test generic shift function
-		ret2, c2 := shiftRun(a) // test run-specific shift function
-		if !reflect.DeepEqual(ret1.runs(), test.exp) && c1 == test.carry && ret1.N() == test.en {
-			t.Fatalf("test #%v shift() expected %v, but got %v %d", i, test.exp, ret1.runs(), ret1.N())
-		} else if !reflect.DeepEqual(ret2.runs(), test.exp) && c2 == test.carry && ret2.N() == test.en {
-			t.Fatalf("test #%v shiftRun() expected %v, but got %v %d", i, test.exp, ret2.runs(), ret2.N())
-		}
+		checkShiftByOne(t, i, NewContainerRun(test.runs), NewContainerRun(test.exp).Slice(), test.carry)
 	}
 }
 
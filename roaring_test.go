@@ -301,6 +301,226 @@ func TestBitmap_SliceRange(t *testing.T) {
 }
 
 // Ensure a bitmap can loop over a set of values.
+func TestBitmap_NextMany(t *testing.T) {
+	bm := testBM()
+	bm.DirectAdd(0)
+	bm.DirectAdd(3<<16 + 65535)
+	bm.DirectAdd(math.MaxUint64)
+	var exp []uint64
+	for v := range bm.RangeAll() {
+		exp = append(exp, v)
+	}
+
+	for _, size := range []int{1, 3, 64, 1000, 100000} {
+		buf := make([]uint64, size)
+		var got []uint64
+		itr := bm.Iterator()
+		for i := 0; ; i++ {
+			// Mixing calls to Next in shouldn't lose our place.
+			if i%3 == 2 {
+				v, eof := itr.Next()
+				if eof {
+					break
+				}
+				got = append(got, v)
+				continue
+			}
+			n := itr.NextMany(buf)
+			got = append(got, buf[:n]...)
+			if n < size {
+				if n := itr.NextMany(buf); n != 0 {
+					t.Fatalf("size %d: expected eof, got %d values", size, n)
+				}
+				break
+			}
+		}
+		if !slices.Equal(got, exp) {
+			t.Fatalf("size %d: expected %d values, got %d", size, len(exp), len(got))
+		}
+	}
+
+	itr := bm.IteratorAt(3<<16 + 1000)
+	buf := make([]uint64, 30)
+	if n := itr.NextMany(buf); n != 30 || buf[0] != 3<<16+1000 || buf[29] != 4<<16+4 {
+		t.Fatalf("unexpected values after seek: %v", buf[:n])
+	}
+}
+
+func TestBitmap_AppendTo(t *testing.T) {
+	bm := testBM()
+	exp := bm.Slice()
+
+	prefix := []uint64{1, 2, 3}
+	got := bm.AppendTo(prefix)
+	if !slices.Equal(got[:3], prefix) || !slices.Equal(got[3:], exp) {
+		t.Fatalf("unexpected AppendTo result of length %d", len(got))
+	}
+
+	// A dst with exactly enough room is used without growing it.
+	exact := make([]uint64, 0, len(exp))
+	if got := bm.AppendTo(exact); len(got) != len(exp) || &got[0] != &exact[:1][0] {
+		t.Fatal("AppendTo reallocated a dst with exactly enough room")
+	}
+	exact = make([]uint64, 0, len(exp))
+	if got := bm.AppendRangeTo(exact, 0, math.MaxUint64); len(got) != len(exp) || &got[0] != &exact[:1][0] {
+		t.Fatal("AppendRangeTo reallocated a dst with exactly enough room")
+	}
+	// Beyond what iterating costs, Slice allocates only its result.
+	exact = make([]uint64, 0, len(exp))
+	iterating := testing.AllocsPerRun(10, func() { bm.AppendTo(exact) })
+	if n := testing.AllocsPerRun(10, func() { bm.Slice() }); n != iterating+1 {
+		t.Fatalf("expected Slice to allocate %v times, got %v", iterating+1, n)
+	}
+	if got := roaring.NewBitmap().Slice(); got == nil || len(got) != 0 {
+		t.Fatalf("expected an empty, non-nil slice, got %#v", got)
+	}
+
+	for _, r := range [][2]uint64{{0, 0}, {0, math.MaxUint64}, {1<<16 + 5, 2<<16 + 7}, {3<<16 + 1000, 4<<16 + 3}, {5 << 16, 6 << 16}} {
+		var want []uint64
+		for _, v := range exp {
+			if v >= r[0] && v < r[1] {
+				want = append(want, v)
+			}
+		}
+		got := bm.AppendRangeTo(prefix[:1], r[0], r[1])
+		if got[0] != 1 || !slices.Equal(got[1:], want) {
+			t.Fatalf("range [%d, %d): expected %d values, got %d", r[0], r[1], len(want), len(got)-1)
+		}
+		if !slices.Equal(bm.SliceRange(r[0], r[1]), want) {
+			t.Fatalf("SliceRange [%d, %d) mismatch", r[0], r[1])
+		}
+	}
+}
+
+func TestBitmap_RunsGaps(t *testing.T) {
+	bm := testBM()
+	bm.AddRange(5<<16-10, 7<<16+10)  // crosses two boundaries and a full container
+	bm.AddRange(9<<16+65530, 10<<16) // ends on a boundary
+	bm.AddRange(10<<16+1, 10<<16+3)
+	bm.DirectAdd(math.MaxUint64)
+	vals := bm.Slice()
+
+	var exp [][2]uint64
+	for _, v := range vals {
+		if n := len(exp); n > 0 && exp[n-1][1]+1 == v {
+			exp[n-1][1] = v
+			continue
+		}
+		exp = append(exp, [2]uint64{v, v})
+	}
+	got := slices.Collect(bm.Runs())
+	if !slices.Equal(got, exp) {
+		t.Fatalf("expected %d runs, got %d: %v", len(exp), len(got), got[:min(len(got), 10)])
+	}
+
+	for _, r := range [][2]uint64{{0, 10}, {0, 1 << 16}, {1 << 16, 1<<16 + 9}, {2<<16 + 1, 2<<16 + 2}, {2<<16 + 1, 2<<16 + 20},
+		{3<<16 + 500, 6 << 16}, {5 << 16, 6 << 16}, {9 << 16, 11 << 16}, {math.MaxUint64 - 5, math.MaxUint64}, {7, 7}} {
+		var want [][2]uint64
+		for v := r[0]; v < r[1]; v++ {
+			if _, ok := slices.BinarySearch(vals, v); ok {
+				continue
+			}
+			if n := len(want); n > 0 && want[n-1][1]+1 == v {
+				want[n-1][1] = v
+				continue
+			}
+			want = append(want, [2]uint64{v, v})
+		}
+		if got := slices.Collect(bm.Gaps(r[0], r[1])); !slices.Equal(got, want) {
+			t.Fatalf("gaps in [%d, %d): expected %v, got %v", r[0], r[1], want, got)
+		}
+	}
+
+	// Stopping early should be respected.
+	for r := range bm.Runs() {
+		if r != exp[0] {
+			t.Fatalf("expected %v, got %v", exp[0], r)
+		}
+		break
+	}
+
+	// Gaps doesn't follow a run past end.
+	long := roaring.NewBitmap()
+	long.AddRange(0, 1000<<16)
+	counted := &countingContainers{Containers: long.Containers}
+	long.Containers = counted
+	if got := slices.Collect(long.Gaps(0, 10)); len(got) != 0 {
+		t.Fatalf("expected no gaps, got %v", got)
+	}
+	if counted.nexts > 1 {
+		t.Fatalf("expected to visit one container, visited %d", counted.nexts)
+	}
+}
+
+// countingContainers counts the containers its iterators visit.
+type countingContainers struct {
+	roaring.Containers
+	nexts int
+}
+
+func (cc *countingContainers) Iterator(key uint64) (roaring.ContainerIterator, bool) {
+	itr, found := cc.Containers.Iterator(key)
+	return &countingIterator{itr, cc}, found
+}
+
+type countingIterator struct {
+	roaring.ContainerIterator
+	cc *countingContainers
+}
+
+func (ci *countingIterator) Next() bool {
+	ci.cc.nexts++
+	return ci.ContainerIterator.Next()
+}
+
+func TestBitmap_NextAbsent(t *testing.T) {
+	for name, bm := range map[string]*roaring.Bitmap{
+		"slice": roaring.NewSliceBitmap(),
+		"btree": roaring.NewBTreeBitmap(),
+		"map":   roaring.NewMapBitmap(),
+		"art":   roaring.NewARTBitmap(),
+	} {
+		bm.UnionInPlace(testBM())
+		bm.AddRange(5<<16-10, 7<<16+10)
+		bm.AddRange(2<<16, 2<<16+200) // fills some of the bitmap's words
+		bm.AddRange(math.MaxUint64-3, math.MaxUint64)
+		bm.DirectAdd(math.MaxUint64)
+		vals := bm.Slice()
+		contains := func(v uint64) bool {
+			_, ok := slices.BinarySearch(vals, v)
+			return ok
+		}
+
+		probes := []uint64{0, 1 << 16, 1<<16 + 4, 2 << 16, 2<<16 + 63, 2<<16 + 199, 2<<16 + 300, 3 << 16, 3<<16 + 1023,
+			4 << 16, 4<<16 + 65534, 5<<16 - 10, 5 << 16, 6<<16 + 12345, math.MaxUint64 - 4}
+		for _, probe := range probes {
+			exp := probe
+			for contains(exp) {
+				exp++
+			}
+			if got, ok := bm.NextAbsent(probe); !ok || got != exp {
+				t.Fatalf("%s: NextAbsent(%d): expected %d, got %d/%v", name, probe, exp, got, ok)
+			}
+		}
+		if _, ok := bm.NextAbsent(math.MaxUint64 - 2); ok {
+			t.Fatalf("%s: expected nothing absent after %d", name, uint64(math.MaxUint64-2))
+		}
+
+		for _, r := range [][2]uint64{{0, 100}, {1<<16 + 1000, 1<<16 + 1030}, {3<<16 + 1000, 3<<16 + 1030},
+			{5<<16 - 20, 7<<16 + 20}, {math.MaxUint64 - 10, math.MaxUint64}} {
+			var want []uint64
+			for v := r[0]; v < r[1]; v++ {
+				if !contains(v) {
+					want = append(want, v)
+				}
+			}
+			if got := slices.Collect(bm.ComplementRange(r[0], r[1])); !slices.Equal(got, want) {
+				t.Fatalf("%s: complement of [%d, %d): expected %v, got %v", name, r[0], r[1], want, got)
+			}
+		}
+	}
+}
+
 func TestBitmap_ForEach(t *testing.T) {
 	var a []uint64
 	_ = roaring.NewFileBitmap(1, 2, 3).ForEach(func(v uint64) error {
@@ -330,6 +550,62 @@ func TestBitmap_ForEachRange(t *testing.T) {
 	}
 }
 
+// Ensure a bitmap can iterate backward from any value, with each backend.
+func TestBitmap_ReverseIterator(t *testing.T) {
+	for name, bm := range map[string]*roaring.Bitmap{
+		"slice": roaring.NewSliceBitmap(),
+		"btree": roaring.NewBTreeBitmap(),
+		"map":   roaring.NewMapBitmap(),
+		"art":   roaring.NewARTBitmap(),
+	} {
+		bm.UnionInPlace(testBM())
+		bm.DirectAdd(0)
+		bm.DirectAdd(3<<16 + 65535)
+		bm.DirectAdd(1 << 40)
+		bm.DirectAdd(math.MaxUint64)
+		vals := bm.Slice()
+
+		var got []uint64
+		for v := range bm.RangeAllReverse() {
+			got = append(got, v)
+		}
+		slices.Reverse(got)
+		if !slices.Equal(got, vals) {
+			t.Fatalf("%s: expected %d values in reverse, got %d", name, len(vals), len(got))
+		}
+
+		probes := []uint64{0, 1, 1 << 16, 1<<16 + 3, 1<<16 + 4, 2<<16 + 16383, 3<<16 + 1023, 3<<16 + 1024,
+			3<<16 + 65535, 4<<16 + 100, 5 << 16, 1<<40 - 1, 1 << 40, math.MaxUint64 - 1, math.MaxUint64}
+		for _, probe := range probes {
+			i, found := slices.BinarySearch(vals, probe)
+			if !found {
+				i--
+			}
+			exp := slices.Clone(vals[max(i-2, 0) : i+1])
+			slices.Reverse(exp)
+
+			itr := bm.ReverseIteratorAt(probe)
+			for _, e := range exp {
+				if v, eof := itr.Next(); eof || v != e {
+					t.Fatalf("%s: after seeking to %d, expected %d, got %d/%v", name, probe, e, v, eof)
+				}
+			}
+			v, ok := bm.MaxAt(probe)
+			if !ok || v != exp[0] {
+				t.Fatalf("%s: MaxAt(%d): expected %d, got %d/%v", name, probe, exp[0], v, ok)
+			}
+		}
+
+		bm.Remove(0)
+		if v, ok := bm.MaxAt(0); ok {
+			t.Fatalf("%s: unexpected MaxAt(0): %d", name, v)
+		}
+	}
+	if _, eof := roaring.NewBitmap().ReverseIterator().Next(); !eof {
+		t.Fatal("expected eof for empty bitmap")
+	}
+}
+
 // Ensure bitmap can return the highest value.
 func TestBitmap_Max(t *testing.T) {
 	bm := roaring.NewFileBitmap()
@@ -344,6 +620,20 @@ func TestBitmap_Max(t *testing.T) {
 	}
 }
 
+// Ensure Max skips empty containers left behind by removals.
+func TestBitmap_MaxAfterRemoveN(t *testing.T) {
+	bm := roaring.NewBitmap(1, 70000)
+	// Removing values that aren't there can still create their containers.
+	bm.DirectRemoveN(1<<20, 1<<40)
+	if v := bm.Max(); v != 70000 {
+		t.Fatalf("max: got=%d; want=70000", v)
+	}
+	bm.DirectRemoveN(1, 70000)
+	if v := bm.Max(); v != 0 {
+		t.Fatalf("max: got=%d; want=0", v)
+	}
+}
+
 // Ensure bitmap can return the lowest value.
 func TestBitmap_Min(t *testing.T) {
 	bm := roaring.NewFileBitmap()
@@ -484,6 +774,16 @@ func TestBitmap_RunCountRange(t *testing.T) {
 	if n := bm3.CountRange(1, 3); n != 2 {
 		t.Fatalf("unexpected n: %d", n)
 	}
+
+	// runs which start at or end on the exclusive end of the range.
+	bm4 := roaring.NewFileBitmap(2, 3, 4, 5, 10, 11, 12)
+	bm4.Optimize() // convert to runs
+	if n := bm4.CountRange(0, 2); n != 0 {
+		t.Fatalf("unexpected n: %d", n)
+	}
+	if n := bm4.CountRange(3, 12); n != 5 {
+		t.Fatalf("unexpected n: %d", n)
+	}
 }
 
 func TestBitmap_Intersection(t *testing.T) {
@@ -1220,6 +1520,143 @@ func TestBitmap_Xor_BitmapBitmap(t *testing.T) {
 	}
 }
 
+func TestBitmap_XorInPlace(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	randomBM := func() *roaring.Bitmap {
+		bm := roaring.NewSliceBitmap()
+		for key := uint64(0); key < 8; key++ {
+			base := key << 16
+			switch rnd.Intn(4) {
+			case 0: // array
+				for i := 0; i < 100; i++ {
+					_, _ = bm.Add(base + uint64(rnd.Intn(65536)))
+				}
+			case 1: // bitmap
+				for i := 0; i < 10000; i++ {
+					_, _ = bm.Add(base + uint64(rnd.Intn(65536)))
+				}
+			case 2: // runs
+				for i := 0; i < 10; i++ {
+					start := base + uint64(rnd.Intn(65536))
+					bm.AddRange(start, start+uint64(rnd.Intn(5000)))
+				}
+			}
+		}
+		bm.Optimize()
+		return bm
+	}
+
+	for i := 0; i < 20; i++ {
+		bm := randomBM()
+		others := []*roaring.Bitmap{randomBM(), randomBM(), randomBM()}
+		before := make([][]uint64, len(others))
+		exp := bm
+		for j, other := range others {
+			before[j] = other.Slice()
+			exp = exp.Xor(other)
+		}
+
+		bm.XorInPlace(others...)
+		if !slices.Equal(bm.Slice(), exp.Slice()) {
+			t.Fatalf("expected %d bits, got %d", exp.Count(), bm.Count())
+		}
+		if err := bm.Check(); err != nil {
+			t.Fatal(err)
+		}
+		for j, other := range others {
+			if !slices.Equal(other.Slice(), before[j]) {
+				t.Fatalf("XorInPlace modified operand %d", j)
+			}
+		}
+	}
+
+	bm := testBM()
+	bm.XorInPlace(bm)
+	if n := bm.Count(); n != 0 {
+		t.Fatalf("unexpected n: %d", n)
+	}
+}
+
+func TestBitmap_CountOps(t *testing.T) {
+	bm0 := testBM()
+	bm1 := roaring.NewBitmap()
+	bm1.AddRange(1<<16, 1<<16+100)      // overlaps the array
+	bm1.AddRange(3<<16+512, 3<<16+2048) // overlaps the small run
+	bm1.AddRange(7<<16, 8<<16)          // overlaps nothing
+	empty := roaring.NewBitmap()
+
+	for _, pair := range [][2]*roaring.Bitmap{{bm0, bm1}, {bm1, bm0}, {bm0, empty}, {empty, bm1}, {bm0, bm0}, {empty, empty}} {
+		a, b := pair[0], pair[1]
+		if got, exp := a.UnionCount(b), a.Union(b).Count(); got != exp {
+			t.Fatalf("UnionCount: expected %d, got %d", exp, got)
+		}
+		if got, exp := a.DifferenceCount(b), a.Difference(b).Count(); got != exp {
+			t.Fatalf("DifferenceCount: expected %d, got %d", exp, got)
+		}
+		if got, exp := a.XorCount(b), a.Xor(b).Count(); got != exp {
+			t.Fatalf("XorCount: expected %d, got %d", exp, got)
+		}
+		if got, exp := a.Intersects(b), a.IntersectionCount(b) > 0; got != exp {
+			t.Fatalf("Intersects: expected %v, got %v", exp, got)
+		}
+	}
+
+	if j := bm0.Jaccard(bm0); j != 1 {
+		t.Fatalf("unexpected self similarity: %v", j)
+	}
+	if j := bm0.Jaccard(empty); j != 0 {
+		t.Fatalf("unexpected similarity with empty: %v", j)
+	}
+	if j := empty.Jaccard(empty); j != 0 {
+		t.Fatalf("unexpected similarity of empty bitmaps: %v", j)
+	}
+	exp := float64(bm0.IntersectionCount(bm1)) / float64(bm0.Union(bm1).Count())
+	if j := bm0.Jaccard(bm1); j != exp || j != bm1.Jaccard(bm0) {
+		t.Fatalf("expected similarity %v, got %v", exp, j)
+	}
+
+	disjoint := roaring.NewBitmap(2<<16+1, 2<<16+3, 9<<16)
+	if bm0.Intersects(disjoint) {
+		t.Fatal("expected no intersection")
+	}
+}
+
+func TestBitmap_SubsetCompare(t *testing.T) {
+	bm := testBM()
+	sub := bm.Clone()
+	sub.RemoveRange(2<<16+100, 3<<16+10)
+	prefix := bm.Clone()
+	prefix.RemoveRange(4<<16+65000, 5<<16)
+	other := bm.Clone()
+	other.AddRange(2<<16+1, 2<<16+2)
+	empty := roaring.NewBitmap()
+
+	bitmaps := []*roaring.Bitmap{bm, sub, prefix, other, empty,
+		roaring.NewBitmap(1 << 16), roaring.NewBitmap(1<<16, 1<<40), roaring.NewBTreeBitmap(1<<16 + 4),
+		roaring.NewBitmap(5), roaring.NewBitmap(5, 6), roaring.NewBitmap(5, 1<<40), roaring.NewMapBitmap(6)}
+	for i, a := range bitmaps {
+		for j, b := range bitmaps {
+			as, bs := a.Slice(), b.Slice()
+			subset := true
+			for _, v := range as {
+				if _, ok := slices.BinarySearch(bs, v); !ok {
+					subset = false
+					break
+				}
+			}
+			if got := a.IsSubsetOf(b); got != subset {
+				t.Fatalf("%d subset of %d: expected %v, got %v", i, j, subset, got)
+			}
+			if got := b.IsSupersetOf(a); got != subset {
+				t.Fatalf("%d superset of %d: expected %v, got %v", j, i, subset, got)
+			}
+			if got, exp := a.Compare(b), slices.Compare(as, bs); got != exp {
+				t.Fatalf("compare %d to %d: expected %d, got %d", i, j, exp, got)
+			}
+		}
+	}
+}
+
 // Ensure bitmap contents alternate.
 func TestBitmap_Flip_Empty(t *testing.T) {
 	bm := roaring.NewFileBitmap()
@@ -1285,6 +1722,83 @@ func TestBitmap_Flip_After(t *testing.T) {
 
 }
 
+func TestBitmap_RangeOps(t *testing.T) {
+	const max = 5 * 65536
+	ops := []struct {
+		name  string
+		fn    func(b *roaring.Bitmap, start, end uint64)
+		apply func(set bool) bool
+	}{
+		{"AddRange", (*roaring.Bitmap).AddRange, func(bool) bool { return true }},
+		{"RemoveRange", (*roaring.Bitmap).RemoveRange, func(bool) bool { return false }},
+		{"FlipInPlace", (*roaring.Bitmap).FlipInPlace, func(set bool) bool { return !set }},
+	}
+	bitmaps := map[string]func() *roaring.Bitmap{
+		"slice": func() *roaring.Bitmap { return roaring.NewSliceBitmap() },
+		"btree": func() *roaring.Bitmap { return roaring.NewBTreeBitmap() },
+		"map":   func() *roaring.Bitmap { return roaring.NewMapBitmap() },
+		"art":   func() *roaring.Bitmap { return roaring.NewARTBitmap() },
+	}
+	rnd := rand.New(rand.NewSource(7))
+	for bname, newBM := range bitmaps {
+		bm := newBM()
+		var model [max]bool
+		for i := 0; i < 200; i++ {
+			op := ops[rnd.Intn(len(ops))]
+			start := uint64(rnd.Intn(max))
+			end := start + uint64(rnd.Intn(3*65536))
+			if end > max {
+				end = max
+			}
+			op.fn(bm, start, end)
+			for v := start; v < end; v++ {
+				model[v] = op.apply(model[v])
+			}
+
+			var exp []uint64
+			for v, set := range model {
+				if set {
+					exp = append(exp, uint64(v))
+				}
+			}
+			if got := bm.Slice(); !slices.Equal(got, exp) {
+				t.Fatalf("%s: %s(%d, %d): got %d values, expected %d", bname, op.name, start, end, len(got), len(exp))
+			}
+		}
+	}
+}
+
+func TestBitmap_RangeOps_Edges(t *testing.T) {
+	bm := roaring.NewBitmap(1, 2, math.MaxUint64)
+	bm.AddRange(5, 5)
+	bm.RemoveRange(9, 3)
+	bm.FlipInPlace(2, 2)
+	if got := bm.Slice(); !reflect.DeepEqual(got, []uint64{1, 2, math.MaxUint64}) {
+		t.Fatalf("empty ranges changed bitmap: %v", got)
+	}
+
+	bm.AddRange(math.MaxUint64-65537, math.MaxUint64)
+	if n := bm.Count(); n != 65540 {
+		t.Fatalf("unexpected n: %d", n)
+	}
+	if n := bm.CountRange(math.MaxUint64-65536, math.MaxUint64); n != 65536 {
+		t.Fatalf("unexpected n: %d", n)
+	}
+	bm.RemoveRange(3, math.MaxUint64)
+	if got := bm.Slice(); !reflect.DeepEqual(got, []uint64{1, 2, math.MaxUint64}) {
+		t.Fatalf("unexpected %v", got)
+	}
+
+	// Flip is inclusive, and can reach the last possible bit.
+	results := bm.Flip(math.MaxUint64-1, math.MaxUint64)
+	if got := results.Slice(); !reflect.DeepEqual(got, []uint64{1, 2, math.MaxUint64 - 1}) {
+		t.Fatalf("unexpected %v", got)
+	}
+	if got := bm.Slice(); !reflect.DeepEqual(got, []uint64{1, 2, math.MaxUint64}) {
+		t.Fatalf("Flip modified its input: %v", got)
+	}
+}
+
 // Ensure bitmap can return the number of intersecting bits in two arrays.
 func TestBitmap_IntersectionCount_ArrayArray(t *testing.T) {
 	bm0 := roaring.NewFileBitmap(0, 1000001, 1000002, 1000003)
@@ -1392,6 +1906,34 @@ func TestBitmap_IntersectionCount_Mixed(t *testing.T) {
 	}
 }
 
+func TestBitmap_RankSelect(t *testing.T) {
+	bm := testBM()
+	_, _ = bm.Add(7, 1<<40)
+	vals := bm.Slice()
+
+	for i, v := range vals {
+		if got := bm.Rank(v); got != uint64(i+1) {
+			t.Fatalf("Rank(%d): expected %d, got %d", v, i+1, got)
+		}
+		if got := bm.Rank(v - 1); v > 0 && got != uint64(i) {
+			t.Fatalf("Rank(%d): expected %d, got %d", v-1, i, got)
+		}
+		got, ok := bm.Select(uint64(i))
+		if !ok || got != v {
+			t.Fatalf("Select(%d): expected %d, got %d/%v", i, v, got, ok)
+		}
+	}
+	if got := bm.Rank(math.MaxUint64); got != uint64(len(vals)) {
+		t.Fatalf("Rank(max): expected %d, got %d", len(vals), got)
+	}
+	if _, ok := bm.Select(uint64(len(vals))); ok {
+		t.Fatalf("Select past end should fail")
+	}
+	if _, ok := roaring.NewFileBitmap().Select(0); ok {
+		t.Fatalf("Select on empty bitmap should fail")
+	}
+}
+
 func TestBitmap_Shift(t *testing.T) {
 	var max uint64 = math.MaxUint64
 	bm1 := roaring.NewFileBitmap(0, 1, 2, 3, 4, 5, 6, 7, 9, 10, 65536, max)
@@ -1420,6 +1962,39 @@ func TestBitmap_Shift(t *testing.T) {
 	}
 }
 
+func TestBitmap_ShiftN(t *testing.T) {
+	var max uint64 = math.MaxUint64
+	bm := testBM()
+	bm.Add(0, 1, 65535, 65536*7-3, 1<<40, max-70000, max-1, max)
+	vals := bm.Slice()
+	shifts := []int{0, 1, -1, 3, -3, 63, -64, 65535, -65535, 65536, -65536, 65537, -65537,
+		65536*3 + 100, -(65536*3 + 100), 1 << 40, -(1 << 40), math.MaxInt64, math.MinInt64}
+	for _, n := range shifts {
+		var exp []uint64
+		for _, v := range vals {
+			if n >= 0 && v <= max-uint64(n) {
+				exp = append(exp, v+uint64(n))
+			} else if n < 0 && v >= uint64(-n) {
+				exp = append(exp, v-uint64(-n))
+			}
+		}
+		got, err := bm.Shift(n)
+		if err != nil {
+			t.Fatalf("shift %d: %v", n, err)
+		}
+		if !slices.Equal(got.Slice(), exp) {
+			t.Fatalf("shift %d: expected %d values, got %d", n, len(exp), got.Count())
+		}
+		if err := got.Check(); err != nil {
+			t.Fatalf("shift %d: %v", n, err)
+		}
+	}
+	// shifting must not modify the original
+	if !slices.Equal(bm.Slice(), vals) {
+		t.Fatal("shift modified its input")
+	}
+}
+
 func TestBitmap_Quick_Array1(t *testing.T)     { testBitmapQuick(t, 1000, 1000, 2000) }
 func TestBitmap_Quick_Array2(t *testing.T)     { testBitmapQuick(t, 1000, 0, 1000) }
 func TestBitmap_Quick_Bitmap1(t *testing.T)    { testBitmapQuick(t, 1000, 0, 10000) }
@@ -1909,8 +2484,8 @@ const (
 	MaxContainerVal = 0xffff
 )
 
-var bmFuncs = []func(a ...uint64) *roaring.Bitmap{roaring.NewBitmap, roaring.NewBTreeBitmap, roaring.NewMapBitmap}
-var bmFuncNames = []string{"slice", "btree", "map"}
+var bmFuncs = []func(a ...uint64) *roaring.Bitmap{roaring.NewBitmap, roaring.NewBTreeBitmap, roaring.NewMapBitmap, roaring.NewARTBitmap}
+var bmFuncNames = []string{"slice", "btree", "map", "art"}
 
 func BenchmarkContainerLinear(b *testing.B) {
 	for i, bmMaker := range bmFuncs {
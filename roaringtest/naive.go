@@ -0,0 +1,64 @@
+// Copyright 2022 Molecula Corp. (DBA FeatureBase).
+// SPDX-License-Identifier: Apache-2.0
+package roaringtest
+
+import (
+	"slices"
+
+	"github.com/gernest/roaring"
+)
+
+// Bitmaps are checked against sorted value slices built with the helpers
+// in internal/naive, the same slice model the roaring package's own tests
+// use. A Containers is checked against naiveContainers instead: it is
+// keyed, because a Containers may hold empty containers, whose keys still
+// count toward Size and are still visited by iteration, and a slice of
+// values has no way to represent them.
+
+// naiveContainers maps keys to the sorted values of their containers,
+// modelling a Containers.
+type naiveContainers map[uint64][]uint16
+
+func (nc naiveContainers) put(key uint64, c *roaring.Container) {
+	nc[key] = slices.Clone(c.Slice())
+}
+
+func (nc naiveContainers) clone() naiveContainers {
+	out := make(naiveContainers, len(nc))
+	for k, v := range nc {
+		out[k] = v
+	}
+	return out
+}
+
+func (nc naiveContainers) count() (n uint64) {
+	for _, v := range nc {
+		n += uint64(len(v))
+	}
+	return n
+}
+
+// keys returns the keys of nc in order.
+func (nc naiveContainers) keys() []uint64 {
+	keys := make([]uint64, 0, len(nc))
+	for k := range nc {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// seek returns the keys an iterator starting at key should visit, and
+// whether key is present.
+func (nc naiveContainers) seek(key uint64, reverse bool) (keys []uint64, found bool) {
+	_, found = nc[key]
+	for _, k := range nc.keys() {
+		if (!reverse && k >= key) || (reverse && k <= key) {
+			keys = append(keys, k)
+		}
+	}
+	if reverse {
+		slices.Reverse(keys)
+	}
+	return keys, found
+}
@@ -0,0 +1,609 @@
+// Copyright 2022 Molecula Corp. (DBA FeatureBase).
+// SPDX-License-Identifier: Apache-2.0
+
+// Package roaringtest checks that an implementation of roaring.Containers
+// obeys the contract the rest of the roaring package relies on: iterator
+// seek semantics, the write flag of Update and UpdateEvery, the
+// independence of frozen and cloned copies, Repair, Reset and ResetN.
+// Besides direct tests of each of these, it makes random changes to
+// Containers, and to Bitmaps built on them, and compares the results
+// against naive models.
+//
+// A package providing a Containers implementation would typically have a
+// test like:
+//
+//	func TestContainers(t *testing.T) {
+//		roaringtest.TestContainers(t, func() roaring.Containers {
+//			return newMyContainers()
+//		})
+//	}
+package roaringtest
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/gernest/roaring"
+	"github.com/gernest/roaring/internal/naive"
+)
+
+// TestContainers runs the whole suite. newContainers must return a new,
+// empty Containers each time it is called.
+func TestContainers(t *testing.T, newContainers func() roaring.Containers) {
+	for _, test := range []struct {
+		name string
+		fn   func(*testing.T, func() roaring.Containers)
+	}{
+		{"Empty", testEmpty},
+		{"PutGetRemove", testPutGetRemove},
+		{"GetOrCreate", testGetOrCreate},
+		{"Seek", testSeek},
+		{"Update", testUpdate},
+		{"UpdateEvery", testUpdateEvery},
+		{"Freeze", testCopy((roaring.Containers).Freeze)},
+		{"Clone", testCopy((roaring.Containers).Clone)},
+		{"Repair", testRepair},
+		{"Reset", testReset},
+		{"Differential", testDifferential},
+		{"BitmapDifferential", testBitmapDifferential},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newContainers)
+		})
+	}
+}
+
+// array returns an array container holding a.
+func array(a ...uint16) *roaring.Container {
+	return roaring.NewContainerArray(a)
+}
+
+// checkContainers checks that cs holds exactly what want does, and that
+// iterators seeking to each of seeks, in either direction if cs supports
+// reverse iteration, visit the keys they should.
+func checkContainers(t *testing.T, cs roaring.Containers, want naiveContainers, seeks ...uint64) {
+	t.Helper()
+	if got := cs.Size(); got != len(want) {
+		t.Fatalf("Size: expected %d, got %d", len(want), got)
+	}
+	if got := cs.Count(); got != want.count() {
+		t.Fatalf("Count: expected %d, got %d", want.count(), got)
+	}
+	keys := want.keys()
+	for _, k := range keys {
+		if got := cs.Get(k).Slice(); !slices.Equal(got, want[k]) {
+			t.Fatalf("Get(%d): expected %d values, got %d", k, len(want[k]), len(got))
+		}
+	}
+	lk, lc := cs.Last()
+	if len(keys) == 0 {
+		if lk != 0 || lc != nil {
+			t.Fatalf("Last: expected nothing, got key %d", lk)
+		}
+	} else if k := keys[len(keys)-1]; lk != k || !slices.Equal(lc.Slice(), want[k]) {
+		t.Fatalf("Last: expected key %d, got %d", k, lk)
+	}
+	// ReverseIterator is optional.
+	directions := []bool{false}
+	rc, ok := cs.(roaring.ReverseContainers)
+	if ok {
+		directions = append(directions, true)
+	}
+	for _, seek := range seeks {
+		for _, reverse := range directions {
+			var it roaring.ContainerIterator
+			var found bool
+			if reverse {
+				it, found = rc.ReverseIterator(seek)
+			} else {
+				it, found = cs.Iterator(seek)
+			}
+			keys, wantFound := want.seek(seek, reverse)
+			if found != wantFound {
+				t.Fatalf("seek %d (reverse %t): expected found %t", seek, reverse, wantFound)
+			}
+			for _, k := range keys {
+				if !it.Next() {
+					t.Fatalf("seek %d (reverse %t): expected key %d, iterator ended", seek, reverse, k)
+				}
+				gk, gc := it.Value()
+				if gk != k || !slices.Equal(gc.Slice(), want[k]) {
+					t.Fatalf("seek %d (reverse %t): expected key %d, got %d", seek, reverse, k, gk)
+				}
+			}
+			if it.Next() {
+				gk, _ := it.Value()
+				t.Fatalf("seek %d (reverse %t): expected end, got key %d", seek, reverse, gk)
+			}
+			// Value after the end must not panic.
+			it.Value()
+			it.Close()
+		}
+	}
+}
+
+func testEmpty(t *testing.T, newContainers func() roaring.Containers) {
+	cs := newContainers()
+	if cs.Get(0) != nil {
+		t.Fatal("expected no container at 0")
+	}
+	checkContainers(t, cs, naiveContainers{}, 0, 1, ^uint64(0))
+}
+
+func testPutGetRemove(t *testing.T, newContainers func() roaring.Containers) {
+	cs := newContainers()
+	want := naiveContainers{}
+	// Out of order, so implementations which append have to sort.
+	for _, k := range []uint64{5, 1, 1 << 40, 3, 1 << 20} {
+		c := array(uint16(k), uint16(k+1))
+		cs.Put(k, c)
+		want.put(k, c)
+	}
+	checkContainers(t, cs, want, 0, 4, ^uint64(0))
+	if cs.Get(2) != nil {
+		t.Fatal("expected no container at 2")
+	}
+
+	// Replacing a container doesn't add a key.
+	c := array(7, 8, 9)
+	cs.Put(3, c)
+	want.put(3, c)
+	checkContainers(t, cs, want, 3)
+
+	cs.Remove(3)
+	delete(want, 3)
+	cs.Remove(1 << 40)
+	delete(want, 1<<40)
+	// Removing a missing key does nothing.
+	cs.Remove(2)
+	checkContainers(t, cs, want, 0, 3, 1<<40, ^uint64(0))
+}
+
+func testGetOrCreate(t *testing.T, newContainers func() roaring.Containers) {
+	cs := newContainers()
+	c := cs.GetOrCreate(9)
+	if c == nil || c.N() != 0 {
+		t.Fatal("expected a new, empty container")
+	}
+	if cs.Size() != 1 || cs.Get(9) == nil {
+		t.Fatal("expected the new container to be stored")
+	}
+	cs.Put(9, array(1, 2))
+	if got := cs.GetOrCreate(9).Slice(); !slices.Equal(got, []uint16{1, 2}) {
+		t.Fatalf("expected the existing container, got %v", got)
+	}
+	if cs.Size() != 1 {
+		t.Fatalf("expected 1 container, got %d", cs.Size())
+	}
+}
+
+func testSeek(t *testing.T, newContainers func() roaring.Containers) {
+	cs := newContainers()
+	want := naiveContainers{}
+	keys := []uint64{1, 2, 3, 5, 6, 100, 1 << 20, 1 << 40, 1<<48 - 1}
+	// Insert alternately from each end.
+	for i := range keys {
+		k := keys[i/2]
+		if i%2 == 1 {
+			k = keys[len(keys)-1-i/2]
+		}
+		c := array(uint16(k))
+		cs.Put(k, c)
+		want.put(k, c)
+	}
+	seeks := []uint64{0, ^uint64(0)}
+	for _, k := range keys {
+		seeks = append(seeks, k-1, k, k+1)
+	}
+	checkContainers(t, cs, want, seeks...)
+}
+
+func testUpdate(t *testing.T, newContainers func() roaring.Containers) {
+	cs := newContainers()
+	update := func(key uint64, existing []uint16, c *roaring.Container, write bool) {
+		t.Helper()
+		calls := 0
+		cs.Update(key, func(old *roaring.Container, existed bool) (*roaring.Container, bool) {
+			calls++
+			if existed != (existing != nil) {
+				t.Fatalf("Update(%d): expected existed %t", key, existing != nil)
+			}
+			if got := old.Slice(); !slices.Equal(got, existing) {
+				t.Fatalf("Update(%d): expected existing %v, got %v", key, existing, got)
+			}
+			return c, write
+		})
+		if calls != 1 {
+			t.Fatalf("Update(%d): expected one call, got %d", key, calls)
+		}
+	}
+
+	update(4, nil, array(1), false)
+	checkContainers(t, cs, naiveContainers{}, 4)
+	update(4, nil, array(1, 2), true)
+	checkContainers(t, cs, naiveContainers{4: {1, 2}}, 4)
+	update(4, []uint16{1, 2}, array(3), false)
+	checkContainers(t, cs, naiveContainers{4: {1, 2}}, 4)
+	update(4, []uint16{1, 2}, array(3), true)
+	update(2, nil, array(5), true)
+	checkContainers(t, cs, naiveContainers{2: {5}, 4: {3}}, 0, 3, 4)
+}
+
+func testUpdateEvery(t *testing.T, newContainers func() roaring.Containers) {
+	cs := newContainers()
+	want := naiveContainers{}
+	for _, k := range []uint64{8, 1, 5, 1 << 30} {
+		c := array(uint16(k))
+		cs.Put(k, c)
+		want.put(k, c)
+	}
+	var seen []uint64
+	cs.UpdateEvery(func(key uint64, c *roaring.Container, existed bool) (*roaring.Container, bool) {
+		seen = append(seen, key)
+		if !existed || !slices.Equal(c.Slice(), want[key]) {
+			t.Fatalf("UpdateEvery: unexpected container for %d", key)
+		}
+		if key%2 == 0 {
+			return c, false
+		}
+		return array(uint16(key), 1000), true
+	})
+	slices.Sort(seen)
+	if keys := want.keys(); !slices.Equal(seen, keys) {
+		t.Fatalf("UpdateEvery: expected calls for %v, got %v", keys, seen)
+	}
+	want[1] = []uint16{1, 1000}
+	want[5] = []uint16{5, 1000}
+	checkContainers(t, cs, want, 0, 5, ^uint64(0))
+}
+
+// testCopy checks that the copy made by cp, and the original, are
+// unaffected by changes to each other, whether those are made through a
+// Bitmap or by modifying containers obtained from them.
+func testCopy(cp func(roaring.Containers) roaring.Containers) func(*testing.T, func() roaring.Containers) {
+	return func(t *testing.T, newContainers func() roaring.Containers) {
+		b := &roaring.Bitmap{Containers: newContainers()}
+		b.AddRange(0, 70000)                  // run containers
+		b.DirectAddN(1<<20, 1<<20+2, 1<<20+5) // an array container
+		for v := uint64(1 << 30); v < 1<<30+10000; v += 2 {
+			b.DirectAdd(v) // a bitmap container
+		}
+		want := b.Slice()
+
+		other := &roaring.Bitmap{Containers: cp(b.Containers)}
+		otherWant := slices.Clone(want)
+		check := func() {
+			t.Helper()
+			checkBitmap(t, b, want)
+			checkBitmap(t, other, otherWant)
+		}
+		check()
+
+		modify := func(b *roaring.Bitmap, want []uint64) []uint64 {
+			_, _ = b.Add(3, 1<<20+1, 1<<30+1, 1<<40)
+			want = naive.Union(want, []uint64{3, 1<<20 + 1, 1<<30 + 1, 1 << 40})
+			_, _ = b.Remove(4, 1<<20, 1<<30)
+			want = naive.Difference(want, []uint64{4, 1 << 20, 1 << 30})
+			b.RemoveRange(65530, 65540)
+			return naive.Difference(want, naive.Range(want, 65530, 65540))
+		}
+		want = modify(b, want)
+		check()
+		otherWant = modify(other, otherWant)
+		check()
+
+		// Change containers in place where they allow it, without
+		// storing the results. Only the other copy is then known.
+		mutate := func(cs roaring.Containers) {
+			citer, _ := cs.Iterator(0)
+			for citer.Next() {
+				_, c := citer.Value()
+				c.Add(7)
+				c.Remove(0)
+			}
+		}
+		mutate(b.Containers)
+		checkBitmap(t, other, otherWant)
+		want = b.Slice()
+		mutate(other.Containers)
+		checkBitmap(t, b, want)
+	}
+}
+
+func testRepair(t *testing.T, newContainers func() roaring.Containers) {
+	cs := newContainers()
+	words := make([]uint64, 1024)
+	for i := range words {
+		words[i] = 0xff
+	}
+	// The in-place union leaves the container's count unknown.
+	c := roaring.NewContainerBitmap(-1, words)
+	c = c.UnionInPlace(roaring.NewContainerRun([]roaring.Interval16{{Start: 8, Last: 15}}))
+	cs.Put(3, c)
+	cs.Put(5, array(1, 2, 3))
+	cs.Repair()
+	n, ok := cs.Get(3).SafeN()
+	if !ok || n != 1024*8+8 {
+		t.Fatalf("expected repaired count %d, got %d (known %t)", 1024*8+8, n, ok)
+	}
+	if got := cs.Count(); got != 1024*8+8+3 {
+		t.Fatalf("expected total count %d, got %d", 1024*8+8+3, got)
+	}
+}
+
+func testReset(t *testing.T, newContainers func() roaring.Containers) {
+	for _, reset := range []func(roaring.Containers){
+		roaring.Containers.Reset,
+		func(cs roaring.Containers) { cs.ResetN(0) },
+		func(cs roaring.Containers) { cs.ResetN(100) },
+	} {
+		cs := newContainers()
+		for k := uint64(0); k < 10; k++ {
+			cs.Put(k*3, array(uint16(k)))
+		}
+		reset(cs)
+		checkContainers(t, cs, naiveContainers{}, 0, 3, ^uint64(0))
+
+		// It must still be usable.
+		want := naiveContainers{}
+		for k := uint64(10); k > 0; k-- {
+			c := array(uint16(k), 9)
+			cs.Put(k*2, c)
+			want.put(k*2, c)
+		}
+		checkContainers(t, cs, want, 0, 3, 20, ^uint64(0))
+	}
+}
+
+// randKeys returns a source of keys which are sometimes ascending, sometimes clustered
+// and sometimes scattered over the whole key space.
+func randKeys(rnd *rand.Rand) func() uint64 {
+	var next uint64
+	return func() uint64 {
+		switch rnd.Intn(5) {
+		case 0:
+			return rnd.Uint64() >> 16
+		case 1:
+			next += uint64(rnd.Intn(3))
+			return next
+		default:
+			return uint64(rnd.Intn(2000))
+		}
+	}
+}
+
+func testDifferential(t *testing.T, newContainers func() roaring.Containers) {
+	rnd := rand.New(rand.NewSource(24))
+	randKey := randKeys(rnd)
+	randArray := func() *roaring.Container {
+		a := make([]uint16, rnd.Intn(8)+1)
+		for i := range a {
+			a[i] = uint16(rnd.Intn(1 << 16))
+		}
+		slices.Sort(a)
+		return array(slices.Compact(a)...)
+	}
+
+	type snapshot struct {
+		cs   roaring.Containers
+		want naiveContainers
+	}
+	var snaps []snapshot
+	cs, want := newContainers(), naiveContainers{}
+	for i := 0; i < 3000; i++ {
+		key := randKey()
+		switch rnd.Intn(12) {
+		case 0, 1:
+			cs.Remove(key)
+			delete(want, key)
+		case 2:
+			c := randArray()
+			write := rnd.Intn(4) != 0
+			cs.Update(key, func(*roaring.Container, bool) (*roaring.Container, bool) {
+				return c, write
+			})
+			if write {
+				want.put(key, c)
+			}
+		case 3:
+			if rnd.Intn(30) == 0 {
+				keys := want.keys()
+				for _, k := range keys[:len(keys)/2] {
+					want.put(k, array(uint16(k)))
+				}
+				cs.UpdateEvery(func(k uint64, c *roaring.Container, _ bool) (*roaring.Container, bool) {
+					if slices.Contains(keys[:len(keys)/2], k) {
+						return array(uint16(k)), true
+					}
+					return c, false
+				})
+			}
+		case 4:
+			if rnd.Intn(30) == 0 {
+				if rnd.Intn(2) == 0 {
+					snaps = append(snaps, snapshot{cs.Freeze(), want.clone()})
+				} else {
+					snaps = append(snaps, snapshot{cs.Clone(), want.clone()})
+				}
+			}
+		case 5:
+			if got := cs.Get(key).Slice(); !slices.Equal(got, want[key]) {
+				t.Fatalf("Get(%d): expected %v, got %v", key, want[key], got)
+			}
+		case 6:
+			c := cs.GetOrCreate(key)
+			if _, ok := want[key]; !ok {
+				want.put(key, c)
+			}
+		case 7:
+			// Remove the last key, then add keys past it.
+			if keys := want.keys(); len(keys) > 0 {
+				k := keys[len(keys)-1]
+				cs.Remove(k)
+				delete(want, k)
+				for j := uint64(1); j < 4 && k+j > k; j++ {
+					c := array(uint16(j))
+					cs.Put(k+j, c)
+					want.put(k+j, c)
+				}
+			}
+		default:
+			c := randArray()
+			cs.Put(key, c)
+			want.put(key, c)
+		}
+		if i%100 == 0 {
+			checkContainers(t, cs, want, 0, key-1, key, key+1, randKey(), ^uint64(0))
+		}
+	}
+	checkContainers(t, cs, want, 0, randKey(), ^uint64(0))
+	for _, s := range snaps {
+		checkContainers(t, s.cs, s.want, 0, randKey(), randKey(), ^uint64(0))
+	}
+	// Resetting the copies must leave the original alone.
+	for _, s := range snaps {
+		s.cs.Reset()
+	}
+	checkContainers(t, cs, want, 0, randKey(), ^uint64(0))
+}
+
+// checkBitmap checks that b holds exactly the values in all, which must
+// be sorted.
+func checkBitmap(t *testing.T, b *roaring.Bitmap, all []uint64) {
+	t.Helper()
+	if got := b.Slice(); !slices.Equal(got, all) {
+		t.Fatalf("expected %d values, got %d", len(all), len(got))
+	}
+	if got := b.Count(); got != uint64(len(all)) {
+		t.Fatalf("Count: expected %d, got %d", len(all), got)
+	}
+	var rev []uint64
+	for v := range b.RangeAllReverse() {
+		rev = append(rev, v)
+	}
+	slices.Reverse(rev)
+	if !slices.Equal(rev, all) {
+		t.Fatalf("RangeAllReverse: expected %d values, got %d", len(all), len(rev))
+	}
+	if len(all) == 0 {
+		return
+	}
+	if got := b.Max(); got != all[len(all)-1] {
+		t.Fatalf("Max: expected %d, got %d", all[len(all)-1], got)
+	}
+	if got, _ := b.Min(); got != all[0] {
+		t.Fatalf("Min: expected %d, got %d", all[0], got)
+	}
+	// Ranges around a few of the values.
+	for _, i := range []int{0, len(all) / 3, len(all) / 2, len(all) - 1} {
+		v := all[i]
+		start, end := v-min(v, 70000), v+70000
+		wantRange := naive.Range(all, start, end)
+		if got := b.SliceRange(start, end); !slices.Equal(got, wantRange) {
+			t.Fatalf("SliceRange(%d, %d): expected %d values, got %d", start, end, len(wantRange), len(got))
+		}
+		if got := b.CountRange(start, end); got != uint64(len(wantRange)) {
+			t.Fatalf("CountRange(%d, %d): expected %d, got %d", start, end, len(wantRange), got)
+		}
+		if got, ok := b.MinAt(v + 1); i < len(all)-1 && (!ok || got != all[i+1]) {
+			t.Fatalf("MinAt(%d): expected %d, got %d", v+1, all[i+1], got)
+		}
+		if got, ok := b.MaxAt(v - 1); i > 0 && (!ok || got != all[i-1]) {
+			t.Fatalf("MaxAt(%d): expected %d, got %d", v-1, all[i-1], got)
+		}
+	}
+}
+
+func testBitmapDifferential(t *testing.T, newContainers func() roaring.Containers) {
+	rnd := rand.New(rand.NewSource(24))
+	randKey := randKeys(rnd)
+	randValues := func() []uint64 {
+		key := randKey() << 16
+		a := make([]uint64, rnd.Intn(200)+1)
+		for i := range a {
+			a[i] = key + uint64(rnd.Intn(1<<16))
+		}
+		return a
+	}
+	newBitmap := func() (*roaring.Bitmap, []uint64) {
+		b := &roaring.Bitmap{Containers: newContainers()}
+		var want []uint64
+		for i := rnd.Intn(10); i > 0; i-- {
+			a := randValues()
+			want = naive.Union(want, a)
+			b.DirectAddN(a...)
+		}
+		return b, want
+	}
+
+	type snapshot struct {
+		b    *roaring.Bitmap
+		want []uint64
+	}
+	var snaps []snapshot
+	b, want := newBitmap()
+	for i := 0; i < 300; i++ {
+		switch rnd.Intn(10) {
+		case 0:
+			a := randValues()
+			want = naive.Union(want, a)
+			_, _ = b.Add(a...)
+		case 1:
+			a := randValues()
+			want = naive.Difference(want, a)
+			_, _ = b.RemoveN(a...)
+		case 2:
+			// Short ranges, often across a container boundary.
+			start := randKey()<<16 + uint64(1<<16-rnd.Intn(4000))
+			end := start + uint64(rnd.Intn(8000))
+			if rnd.Intn(2) == 0 {
+				b.AddRange(start, end)
+				r := make([]uint64, 0, end-start)
+				for v := start; v < end; v++ {
+					r = append(r, v)
+				}
+				want = naive.Union(want, r)
+			} else {
+				b.RemoveRange(start, end)
+				want = naive.Difference(want, naive.Range(want, start, end))
+			}
+		case 3:
+			o, ow := newBitmap()
+			b.UnionInPlace(o)
+			want = naive.Union(want, ow)
+		case 4:
+			o, ow := newBitmap()
+			// Keep some of what's there, so the result isn't empty.
+			o.UnionInPlace(b.OffsetRange(0, 0, 1<<40))
+			ow = naive.Union(ow, naive.Range(want, 0, 1<<40))
+			b.IntersectInPlace(o)
+			want = naive.Intersect(want, ow)
+		case 5:
+			o, ow := newBitmap()
+			b.DifferenceInPlace(o)
+			want = naive.Difference(want, ow)
+		case 6:
+			o, ow := newBitmap()
+			b.XorInPlace(o)
+			want = naive.Xor(want, ow)
+		case 7:
+			if rnd.Intn(2) == 0 {
+				snaps = append(snaps, snapshot{b.Freeze(), slices.Clone(want)})
+			} else {
+				snaps = append(snaps, snapshot{b.Clone(), slices.Clone(want)})
+			}
+		default:
+			a := randValues()
+			want = naive.Union(want, a)
+			b.DirectAddN(a...)
+		}
+		if i%10 == 0 {
+			checkBitmap(t, b, want)
+		}
+	}
+	checkBitmap(t, b, want)
+	for _, s := range snaps {
+		checkBitmap(t, s.b, s.want)
+	}
+}